@@ -0,0 +1,105 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc6749#section-4.1.2
+Spec: http://tools.ietf.org/html/rfc9207
+*/
+
+package oauth2
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Errors returned by ParseCallback.
+var (
+	// ErrStateMismatch is returned when callback "state" parameter
+	// doesn't match the stored state.
+	ErrStateMismatch = errors.New("State mismatch")
+
+	// ErrIssuerMismatch is returned when callback "iss" parameter doesn't
+	// match service Issuer, the response may come from another
+	// authorization server (mix-up attack).
+	ErrIssuerMismatch = errors.New("Issuer mismatch")
+
+	// ErrIssuerMissing is returned when callback has no "iss" parameter
+	// but server metadata says it's always sent.
+	ErrIssuerMissing = errors.New("Issuer missing in authorization response")
+)
+
+// ParseCallback validates authorization response query received on
+// the redirect URI and returns the code.
+//
+// "state" must match expectedState, also in error responses. If "iss"
+// is present it must match service Issuer (not checked if Issuer is
+// empty), it's required when server metadata has
+// "authorization_response_iss_parameter_supported". Error response is
+// returned as *TokenError.
+//
+//	code, err := service.ParseCallback(r.URL.Query(), savedState)
+//	token, err := service.GetAccessToken(code)
+func (service *OAuth2Service) ParseCallback(query url.Values,
+	expectedState string) (string, error) {
+	// http://tools.ietf.org/html/rfc9207#section-2.4
+	// Issuer is checked first, also for error responses.
+	if err := service.checkResponseIssuer(query); err != nil {
+		return "", err
+	}
+	// Error response must have the state too, otherwise anyone could
+	// abort the flow with a forged error.
+	if err := checkState(query, expectedState); err != nil {
+		return "", err
+	}
+	if query.Get("error") != "" {
+		// http://tools.ietf.org/html/rfc6749#section-4.1.2.1
+		return "", &TokenError{
+			ErrorCode:   query.Get("error"),
+			Description: query.Get("error_description"),
+			URI:         query.Get("error_uri"),
+			State:       query.Get("state"),
+		}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("Access code can't be empty")
+	}
+	return code, nil
+}
+
+// checkState compares "state" parameter with expectedState.
+func checkState(query url.Values, expectedState string) error {
+	state := query.Get("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state),
+		[]byte(expectedState)) != 1 {
+		return ErrStateMismatch
+	}
+	return nil
+}
+
+// checkResponseIssuer validates "iss" authorization response parameter.
+func (service *OAuth2Service) checkResponseIssuer(query url.Values) error {
+	if _, ok := query["iss"]; !ok {
+		if service.Metadata != nil &&
+			service.Metadata.AuthorizationResponseIssParameterSupported {
+			return ErrIssuerMissing
+		}
+		return nil
+	}
+	if service.Issuer == "" {
+		// Nothing to compare with, set Issuer (or use Discover) to
+		// defend against mix-up attacks.
+		return nil
+	}
+	// Simple string comparison, without normalization.
+	if query.Get("iss") != service.Issuer {
+		return ErrIssuerMismatch
+	}
+	return nil
+}
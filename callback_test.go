@@ -0,0 +1,97 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestParseCallback(t *testing.T) {
+	service := Service("client", "secret", "https://as.example.com/authorize",
+		"https://as.example.com/token")
+	service.Issuer = "https://as.example.com"
+	tests := []struct {
+		query string
+		err   error
+	}{
+		{"code=c&state=st", nil},
+		{"code=c&state=st&iss=https://as.example.com", nil},
+		{"code=c&state=other&iss=https://as.example.com", ErrStateMismatch},
+		{"code=c&iss=https://as.example.com", ErrStateMismatch},
+		{"code=c&state=st&iss=https://other.example.com", ErrIssuerMismatch},
+		{"error=access_denied&state=st&iss=https://other.example.com",
+			ErrIssuerMismatch},
+		// Error response without valid state may be forged.
+		{"error=access_denied", ErrStateMismatch},
+		{"error=access_denied&state=other", ErrStateMismatch},
+	}
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := service.ParseCallback(query, "st")
+		if err != test.err {
+			t.Errorf("%v: error = %v, want %v", test.query, err, test.err)
+		}
+		if err == nil && code != "c" {
+			t.Errorf("%v: code = %q, want c", test.query, code)
+		}
+	}
+}
+
+func TestParseCallbackErrorResponse(t *testing.T) {
+	service := Service("client", "secret", "https://as.example.com/authorize",
+		"https://as.example.com/token")
+	query := url.Values{
+		"error":             {"access_denied"},
+		"error_description": {"User denied access"},
+		"state":             {"st"},
+	}
+	_, err := service.ParseCallback(query, "st")
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) {
+		t.Fatalf("Error = %#v, want *TokenError", err)
+	}
+	if tokenError.ErrorCode != "access_denied" ||
+		tokenError.Description != "User denied access" ||
+		tokenError.State != "st" {
+		t.Errorf("Error = %+v", tokenError)
+	}
+
+	if _, err := service.ParseCallback(url.Values{"state": {"st"}},
+		"st"); err == nil {
+		t.Error("Callback without code accepted")
+	}
+}
+
+func TestParseCallbackIssuer(t *testing.T) {
+	service := Service("client", "secret", "https://as.example.com/authorize",
+		"https://as.example.com/token")
+	query := url.Values{"code": {"c"}, "state": {"st"},
+		"iss": {"https://other.example.com"}}
+
+	// Without Issuer there is nothing to compare with.
+	if _, err := service.ParseCallback(query, "st"); err != nil {
+		t.Errorf("Empty Issuer: %v", err)
+	}
+
+	service.Issuer = "https://as.example.com"
+	service.Metadata = &ServerMetadata{
+		AuthorizationResponseIssParameterSupported: true,
+	}
+	query.Del("iss")
+	if _, err := service.ParseCallback(query, "st"); err != ErrIssuerMissing {
+		t.Errorf("Error = %v, want ErrIssuerMissing", err)
+	}
+	query.Set("iss", "https://as.example.com")
+	if _, err := service.ParseCallback(query, "st"); err != nil {
+		t.Errorf("Error = %v, want nil", err)
+	}
+}
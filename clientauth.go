@@ -0,0 +1,158 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc6749#section-2.3
+Spec: http://tools.ietf.org/html/rfc7523#section-2.2
+*/
+
+package oauth2
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client assertion type for JWT client authentication.
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientAuth authenticates the client to the authorization server.
+// It's used by every request sent to the token endpoint.
+type ClientAuth interface {
+	// AuthenticateClient adds client credentials to the request header
+	// or to the form parameters sent in the request body.
+	AuthenticateClient(config *Config, header http.Header,
+		params url.Values) error
+}
+
+// Client authentication methods.
+var (
+	// ClientAuthBody sends "client_id" and "client_secret" in the request
+	// body (client_secret_post). This is the default.
+	ClientAuthBody ClientAuth = clientSecretPost{}
+
+	// ClientAuthBasic sends client credentials using HTTP Basic
+	// authentication scheme (client_secret_basic).
+	// http://tools.ietf.org/html/rfc6749#section-2.3.1
+	ClientAuthBasic ClientAuth = clientSecretBasic{}
+
+	// ClientAuthNone sends only "client_id", for public clients (none).
+	ClientAuthNone ClientAuth = clientAuthNone{}
+)
+
+type clientSecretPost struct{}
+
+func (clientSecretPost) AuthenticateClient(config *Config,
+	header http.Header, params url.Values) error {
+	// Client identifier is empty for grants authenticating the client
+	// with assertion only.
+	(*MyUrlValues)(&params).CheckAndSet("client_id", config.ClientId)
+	(*MyUrlValues)(&params).CheckAndSet("client_secret", config.ClientSecret)
+	return nil
+}
+
+type clientSecretBasic struct{}
+
+func (clientSecretBasic) AuthenticateClient(config *Config,
+	header http.Header, params url.Values) error {
+	// Client identifier and password are encoded using
+	// "application/x-www-form-urlencoded" before Basic encoding.
+	credentials := url.QueryEscape(config.ClientId) + ":" +
+		url.QueryEscape(config.ClientSecret)
+	header.Set("Authorization", "Basic "+
+		base64.StdEncoding.EncodeToString([]byte(credentials)))
+	params.Del("client_id")
+	params.Del("client_secret")
+	return nil
+}
+
+type clientAuthNone struct{}
+
+func (clientAuthNone) AuthenticateClient(config *Config,
+	header http.Header, params url.Values) error {
+	params.Set("client_id", config.ClientId)
+	params.Del("client_secret")
+	return nil
+}
+
+// ClientSecretJWT authenticates the client with a JWT signed using
+// the client secret as HMAC key (client_secret_jwt).
+type ClientSecretJWT struct {
+	// HMAC algorithm, default: HS256
+	Algorithm string
+
+	// Lifetime of the assertion, default: 5 minutes
+	Lifetime time.Duration
+}
+
+// AuthenticateClient implements ClientAuth.
+func (auth ClientSecretJWT) AuthenticateClient(config *Config,
+	header http.Header, params url.Values) error {
+	alg := auth.Algorithm
+	if alg == "" {
+		alg = HS256
+	}
+	secret := []byte(config.ClientSecret)
+	return setClientAssertion(config, params, auth.Lifetime,
+		func(claims map[string]interface{}) (string, error) {
+			return signJWT(alg, secret, nil, claims)
+		})
+}
+
+// PrivateKeyJWT authenticates the client with a JWT signed using
+// the client private key (private_key_jwt).
+//
+//	service.ClientAuth = oauth2.PrivateKeyJWT{
+//		JWTSigner: oauth2.JWTSigner{Key: key, KeyID: "k1"},
+//	}
+type PrivateKeyJWT struct {
+	JWTSigner
+}
+
+// AuthenticateClient implements ClientAuth.
+func (auth PrivateKeyJWT) AuthenticateClient(config *Config,
+	header http.Header, params url.Values) error {
+	return setClientAssertion(config, params, auth.lifetime(),
+		func(claims map[string]interface{}) (string, error) {
+			return auth.sign(nil, claims)
+		})
+}
+
+// setClientAssertion builds client assertion, signed by sign, and adds it
+// to params.
+// http://tools.ietf.org/html/rfc7523#section-3
+func setClientAssertion(config *Config, params url.Values,
+	lifetime time.Duration,
+	sign func(claims map[string]interface{}) (string, error)) error {
+	if lifetime <= 0 {
+		lifetime = defaultJWTLifetime
+	}
+	jti, err := newJWTID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": config.ClientId,
+		"sub": config.ClientId,
+		"aud": config.AccessTokenURL.String(),
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(lifetime).Unix(),
+	}
+	assertion, err := sign(claims)
+	if err != nil {
+		return err
+	}
+
+	params.Set("client_id", config.ClientId)
+	params.Del("client_secret")
+	params.Set("client_assertion_type", ClientAssertionTypeJWTBearer)
+	params.Set("client_assertion", assertion)
+	return nil
+}
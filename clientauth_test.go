@@ -0,0 +1,158 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestClientAuthBody(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	if _, err := service.RefreshAccessToken("rt"); err != nil {
+		t.Fatal(err)
+	}
+	r := server.last(t)
+	if r.PostForm.Get("client_id") != "client" ||
+		r.PostForm.Get("client_secret") != "secret" {
+		t.Errorf("Form = %v", r.PostForm)
+	}
+	if r.Header.Get("Authorization") != "" {
+		t.Errorf("Authorization header sent: %q",
+			r.Header.Get("Authorization"))
+	}
+}
+
+func TestClientAuthBasic(t *testing.T) {
+	server := newTokenServer(t)
+	service := Service("my client", "se:cr&t", server.URL+"/authorize",
+		server.URL+"/token")
+	service.ClientAuth = ClientAuthBasic
+	if _, err := service.RefreshAccessToken("rt"); err != nil {
+		t.Fatal(err)
+	}
+	r := server.last(t)
+	// http://tools.ietf.org/html/rfc6749#section-2.3.1
+	username, password, ok := r.BasicAuth()
+	if !ok || username != "my+client" || password != "se%3Acr%26t" {
+		t.Errorf("BasicAuth() = %q, %q, %v", username, password, ok)
+	}
+	if r.PostForm.Get("client_id") != "" ||
+		r.PostForm.Get("client_secret") != "" {
+		t.Errorf("Credentials sent in body: %v", r.PostForm)
+	}
+	if service.AuthHeader.Get("Authorization") != "" {
+		t.Error("Service AuthHeader modified")
+	}
+}
+
+func TestClientAuthNone(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	service.ClientAuth = ClientAuthNone
+	if _, err := service.RefreshAccessToken("rt"); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	if form.Get("client_id") != "client" || form.Get("client_secret") != "" {
+		t.Errorf("Form = %v", form)
+	}
+}
+
+func TestClientSecretJWT(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	service.ClientAuth = ClientSecretJWT{Algorithm: HS384}
+	if _, err := service.RefreshAccessToken("rt"); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	if form.Get("client_secret") != "" {
+		t.Error("client_secret sent")
+	}
+	header, claims := parseTestJWT(t, form.Get("client_assertion"),
+		[]byte("secret"))
+	if header.Algorithm != HS384 {
+		t.Errorf("alg = %q, want %q", header.Algorithm, HS384)
+	}
+	checkClientAssertion(t, service, form.Get("client_assertion_type"),
+		claims)
+}
+
+func TestPrivateKeyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		signer JWTSigner
+		alg    string
+	}{
+		{JWTSigner{Key: rsaKey, KeyID: "k1"}, RS256},
+		{JWTSigner{Key: rsaKey, Algorithm: PS256}, PS256},
+		{JWTSigner{Key: ecKey}, ES384},
+		{JWTSigner{Key: edKey}, EdDSA},
+	}
+
+	server := newTokenServer(t)
+	service := server.service()
+	for _, test := range tests {
+		service.ClientAuth = PrivateKeyJWT{test.signer}
+		if _, err := service.RefreshAccessToken("rt"); err != nil {
+			t.Fatal(err)
+		}
+		form := server.last(t).PostForm
+		header, claims := parseTestJWT(t, form.Get("client_assertion"),
+			test.signer.Key.Public())
+		if header.Algorithm != test.alg || header.KeyID != test.signer.KeyID {
+			t.Errorf("Header = %+v, want alg %q and kid %q", header,
+				test.alg, test.signer.KeyID)
+		}
+		checkClientAssertion(t, service, form.Get("client_assertion_type"),
+			claims)
+	}
+
+	service.ClientAuth = PrivateKeyJWT{}
+	if _, err := service.RefreshAccessToken("rt"); err == nil {
+		t.Error("Empty private key accepted")
+	}
+	service.ClientAuth = PrivateKeyJWT{JWTSigner{Key: rsaKey,
+		Algorithm: ES256}}
+	if _, err := service.RefreshAccessToken("rt"); err == nil {
+		t.Error("RSA key accepted for ES256")
+	}
+}
+
+// checkClientAssertion checks client assertion claims.
+// http://tools.ietf.org/html/rfc7523#section-3
+func checkClientAssertion(t *testing.T, service *OAuth2Service,
+	assertionType string, claims map[string]interface{}) {
+	t.Helper()
+	if assertionType != ClientAssertionTypeJWTBearer {
+		t.Errorf("client_assertion_type = %q", assertionType)
+	}
+	if claims["iss"] != "client" || claims["sub"] != "client" ||
+		claims["aud"] != service.AccessTokenURL.String() {
+		t.Errorf("Claims = %v", claims)
+	}
+	if claims["jti"] == nil || claims["exp"] == nil {
+		t.Errorf("Claims = %v, want jti and exp", claims)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults used by ClientCredentials.
+const (
+	// DefaultRefreshBefore is how long before expiration cached token is
+	// refreshed in the background.
+	DefaultRefreshBefore = time.Minute
+
+	// DefaultMinBackoff is the delay after the first failed request.
+	DefaultMinBackoff = time.Second
+
+	// DefaultMaxBackoff is the maximum delay between failed requests.
+	DefaultMaxBackoff = time.Minute
+)
+
+// ClientCredentials gets and caches client credentials tokens for
+// service-to-service calls, keyed by scope and audience.
+//
+// Cached token is refreshed in the background RefreshBefore its
+// expiration, or in the middle of its lifetime if it's shorter.
+// Concurrent requests for the same key share one token request. After
+// a failure no new request is sent until backoff delay (doubled with each
+// failure) passes. It's safe for concurrent use.
+//
+// Tokens without "expires_in" are cached forever, set
+// service.DefaultTokenLifetime to refresh them.
+//
+//	creds := service.ClientCredentials()
+//	token, err := creds.Token("read:orders", "https://api.example.com")
+//	api := oauth2.RequestTokenSource(apiBaseURL,
+//		creds.TokenSource("read:orders", "https://api.example.com"))
+type ClientCredentials struct {
+	// ExpiryDelta is how long before ExpirationTime the token is
+	// treated as expired, default: DefaultExpiryDelta
+	ExpiryDelta time.Duration
+
+	// RefreshBefore is how long before ExpirationTime background refresh
+	// starts, default: DefaultRefreshBefore
+	RefreshBefore time.Duration
+
+	// MinBackoff and MaxBackoff limit delay after failed requests,
+	// default: DefaultMinBackoff and DefaultMaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	service *OAuth2Service
+
+	mu      sync.Mutex
+	entries map[credentialsKey]*credentialsEntry
+}
+
+type credentialsKey struct {
+	scope, audience string
+}
+
+// credentialsEntry holds cached token and fetch state for one key.
+type credentialsEntry struct {
+	token    *Token
+	fetched  time.Time
+	inflight *tokenFetch
+	failures int
+	retryAt  time.Time
+	lastErr  error
+}
+
+// tokenFetch represents in-flight token request, shared by all callers
+// waiting for it.
+type tokenFetch struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// ClientCredentials initializes client credentials token cache.
+func (service *OAuth2Service) ClientCredentials() *ClientCredentials {
+	return &ClientCredentials{
+		service: service,
+		entries: map[credentialsKey]*credentialsEntry{},
+	}
+}
+
+// Token returns cached token for scope and audience, requesting new one
+// if needed. Empty scope means service Scope, empty audience isn't sent.
+func (cc *ClientCredentials) Token(scope, audience string) (*Token, error) {
+	return cc.TokenContext(context.Background(), scope, audience)
+}
+
+// TokenContext is like Token but uses ctx for the request.
+func (cc *ClientCredentials) TokenContext(ctx context.Context,
+	scope, audience string) (*Token, error) {
+	if scope == "" {
+		scope = cc.service.Scope
+	}
+	key := credentialsKey{scope, audience}
+
+	cc.mu.Lock()
+	entry := cc.entries[key]
+	if entry == nil {
+		entry = &credentialsEntry{}
+		cc.entries[key] = entry
+	}
+	now := time.Now()
+	if entry.token != nil && !entry.token.expiredWithin(cc.expiryDelta()) {
+		token := entry.token
+		if token.expiredWithin(cc.refreshBefore(entry)) &&
+			entry.inflight == nil && !now.Before(entry.retryAt) {
+			// Refresh in the background, token is still valid.
+			cc.fetch(context.WithoutCancel(ctx), key, entry)
+		}
+		cc.mu.Unlock()
+		return token, nil
+	}
+
+	fetch := entry.inflight
+	if fetch == nil {
+		if now.Before(entry.retryAt) {
+			err := entry.lastErr
+			cc.mu.Unlock()
+			return nil, err
+		}
+		// Request isn't cancelled when ctx of the first caller is done,
+		// others may still wait for it.
+		fetch = cc.fetch(context.WithoutCancel(ctx), key, entry)
+	}
+	cc.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TokenSource returns TokenSource for scope and audience using cc.
+func (cc *ClientCredentials) TokenSource(scope, audience string) TokenSource {
+	return &credentialsTokenSource{cc, scope, audience}
+}
+
+type credentialsTokenSource struct {
+	cc              *ClientCredentials
+	scope, audience string
+}
+
+func (s *credentialsTokenSource) Token() (*Token, error) {
+	return s.cc.Token(s.scope, s.audience)
+}
+
+func (s *credentialsTokenSource) TokenContext(ctx context.Context) (
+	*Token, error) {
+	return s.cc.TokenContext(ctx, s.scope, s.audience)
+}
+
+// fetch starts token request for entry, cc.mu must be held.
+func (cc *ClientCredentials) fetch(ctx context.Context, key credentialsKey,
+	entry *credentialsEntry) *tokenFetch {
+	fetch := &tokenFetch{done: make(chan struct{})}
+	entry.inflight = fetch
+
+	go func() {
+		token, err := cc.service.credentialsToken(ctx, key.scope,
+			key.audience)
+
+		cc.mu.Lock()
+		entry.inflight = nil
+		if err != nil {
+			entry.failures++
+			entry.retryAt = time.Now().Add(cc.backoff(entry.failures))
+			entry.lastErr = err
+		} else {
+			entry.token = token
+			entry.fetched = time.Now()
+			entry.failures = 0
+			entry.retryAt = time.Time{}
+			entry.lastErr = nil
+		}
+		cc.mu.Unlock()
+
+		fetch.token, fetch.err = token, err
+		close(fetch.done)
+	}()
+	return fetch
+}
+
+// backoff returns delay after given number of consecutive failures.
+func (cc *ClientCredentials) backoff(failures int) time.Duration {
+	min, max := cc.MinBackoff, cc.MaxBackoff
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	delay := min
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func (cc *ClientCredentials) expiryDelta() time.Duration {
+	if cc.ExpiryDelta <= 0 {
+		return DefaultExpiryDelta
+	}
+	return cc.ExpiryDelta
+}
+
+// refreshBefore returns how long before expiration entry token is
+// refreshed, at most half of the token lifetime.
+func (cc *ClientCredentials) refreshBefore(
+	entry *credentialsEntry) time.Duration {
+	before := cc.RefreshBefore
+	if before <= 0 {
+		before = DefaultRefreshBefore
+	}
+	lifetime := entry.token.ExpirationTime.Sub(entry.fetched)
+	if lifetime/2 < before {
+		return lifetime / 2
+	}
+	return before
+}
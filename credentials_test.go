@@ -0,0 +1,121 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientCredentials(t *testing.T) {
+	server := newTokenServer(t)
+	creds := server.service().ClientCredentials()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := creds.Token("read", "https://api.example.com")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if token.AccessToken != "at" {
+				t.Errorf("AccessToken = %q, want at", token.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+	if server.count() != 1 {
+		t.Fatalf("Sent %d requests, want 1", server.count())
+	}
+	form := server.last(t).PostForm
+	if form.Get("grant_type") != "client_credentials" ||
+		form.Get("scope") != "read" ||
+		form.Get("audience") != "https://api.example.com" {
+		t.Errorf("Form = %v", form)
+	}
+
+	// Other scope gets its own token.
+	if _, err := creds.TokenSource("write", "").Token(); err != nil {
+		t.Fatal(err)
+	}
+	form = server.last(t).PostForm
+	if server.count() != 2 || form.Get("scope") != "write" ||
+		form["audience"] != nil {
+		t.Errorf("Form = %v after %d requests", form, server.count())
+	}
+}
+
+func TestClientCredentialsBackgroundRefresh(t *testing.T) {
+	server := newTokenServer(t)
+	creds := server.service().ClientCredentials()
+	old, err := creds.Token("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token within RefreshBefore is still returned, new one is requested
+	// in the background.
+	creds.mu.Lock()
+	for _, entry := range creds.entries {
+		entry.fetched = time.Now().Add(-time.Hour)
+	}
+	old.ExpirationTime = time.Now().Add(DefaultRefreshBefore / 2)
+	creds.mu.Unlock()
+	server.respond(http.StatusOK, `{"access_token":"new","expires_in":3600}`)
+	token, err := creds.Token("", "")
+	if err != nil || token != old {
+		t.Fatalf("Token() = %v, %v, want cached token", token, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for token.AccessToken != "new" {
+		if time.Now().After(deadline) {
+			t.Fatal("Token not refreshed")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if token, err = creds.Token("", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.count() != 2 {
+		t.Errorf("Sent %d requests, want 2", server.count())
+	}
+}
+
+func TestClientCredentialsBackoff(t *testing.T) {
+	server := newTokenServer(t)
+	server.respond(http.StatusInternalServerError, `{"error":"server_error"}`)
+	creds := server.service().ClientCredentials()
+	for i := 0; i < 3; i++ {
+		if _, err := creds.Token("", ""); err == nil {
+			t.Fatal("Error not returned")
+		}
+	}
+	if server.count() != 1 {
+		t.Errorf("Sent %d requests during backoff, want 1", server.count())
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{3, 4 * time.Second},
+		{100, time.Minute},
+	}
+	for _, test := range tests {
+		if delay := creds.backoff(test.failures); delay != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.failures, delay,
+				test.want)
+		}
+	}
+}
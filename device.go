@@ -0,0 +1,162 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc8628
+*/
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Grant type used to exchange device code for token.
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorization represents a Device Authorization Response.
+type DeviceAuthorization struct {
+	// http://tools.ietf.org/html/rfc8628#section-3.2
+
+	// The device verification code.
+	DeviceCode string `json:"device_code"`
+
+	// The end-user verification code.
+	UserCode string `json:"user_code"`
+
+	// The end-user verification URI on the authorization server.
+	VerificationURI string `json:"verification_uri"`
+
+	// A verification URI that includes the "user_code", designed
+	// for non-textual transmission (like QR codes).
+	VerificationURIComplete string `json:"verification_uri_complete"`
+
+	// The lifetime in seconds of "device_code" and "user_code".
+	ExpiresIn int64 `json:"expires_in"`
+
+	// The minimum amount of time in seconds that the client
+	// should wait between polling requests, default: 5
+	Interval int64 `json:"interval"`
+
+	// The expiration time of the device code, built from ExpiresIn
+	ExpirationTime time.Time `json:"-"`
+}
+
+// GetDeviceCode starts Device Authorization Grant. Show UserCode and
+// VerificationURI to the user, next call GetAccessTokenDevice.
+//
+//	auth, err := service.GetDeviceCode()
+//	fmt.Printf("Visit %v and enter code %v\n",
+//		auth.VerificationURI, auth.UserCode)
+//	token, err := service.GetAccessTokenDevice(auth)
+func (service *OAuth2Service) GetDeviceCode() (*DeviceAuthorization, error) {
+	return service.GetDeviceCodeContext(context.Background())
+}
+
+// GetDeviceCodeContext is like GetDeviceCode but uses ctx for the request.
+func (service *OAuth2Service) GetDeviceCodeContext(ctx context.Context) (
+	*DeviceAuthorization, error) {
+	// http://tools.ietf.org/html/rfc8628#section-3.1
+	if service.DeviceAuthorizationURL.String() == "" {
+		return nil, fmt.Errorf("Device authorization URL not configured")
+	}
+	params := url.Values{}
+	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
+
+	resp, raw, err := service.postForm(ctx,
+		service.DeviceAuthorizationURL.String(), params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp, raw)
+	}
+
+	auth := DeviceAuthorization{}
+	if err := json.Unmarshal(raw, &auth); err != nil {
+		return nil, newParseError(resp, raw, err)
+	}
+	if auth.VerificationURI == "" {
+		// Some providers use pre-standard "verification_url" name.
+		var legacy struct {
+			VerificationURL string `json:"verification_url"`
+		}
+		json.Unmarshal(raw, &legacy)
+		auth.VerificationURI = legacy.VerificationURL
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" ||
+		auth.VerificationURI == "" {
+		return nil, fmt.Errorf("Invalid device authorization response")
+	}
+	if auth.Interval <= 0 {
+		auth.Interval = 5
+	}
+	if auth.ExpiresIn > 0 {
+		auth.ExpirationTime = time.Now().Add(
+			time.Duration(auth.ExpiresIn) * time.Second)
+	}
+	return &auth, nil
+}
+
+// GetAccessTokenDevice polls the token endpoint until the user approves
+// or denies the authorization request, or the device code expires.
+func (service *OAuth2Service) GetAccessTokenDevice(
+	auth *DeviceAuthorization) (*Token, error) {
+	return service.GetAccessTokenDeviceContext(context.Background(), auth)
+}
+
+// GetAccessTokenDeviceContext is like GetAccessTokenDevice but uses ctx
+// for the requests. Polling stops when ctx is done.
+func (service *OAuth2Service) GetAccessTokenDeviceContext(ctx context.Context,
+	auth *DeviceAuthorization) (*Token, error) {
+	// http://tools.ietf.org/html/rfc8628#section-3.4
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	for {
+		if !auth.ExpirationTime.IsZero() &&
+			time.Now().Add(interval).After(auth.ExpirationTime) {
+			return nil, fmt.Errorf("Device code expired")
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		params := url.Values{}
+		params.Set("grant_type", GrantTypeDeviceCode)
+		params.Set("device_code", auth.DeviceCode)
+
+		token, err := service.getToken(ctx, params)
+		if err == nil {
+			return token, nil
+		}
+		var tokenError *TokenError
+		if !errors.As(err, &tokenError) {
+			return nil, err
+		}
+
+		// http://tools.ietf.org/html/rfc8628#section-3.5
+		switch tokenError.ErrorCode {
+		case ErrorAuthorizationPending:
+		case ErrorSlowDown:
+			interval += 5 * time.Second
+		default:
+			// ErrorAccessDenied, ErrorExpiredToken and other errors
+			return nil, err
+		}
+	}
+}
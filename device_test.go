@@ -0,0 +1,144 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetDeviceCode(t *testing.T) {
+	server := newTokenServer(t)
+	// Pre-standard "verification_url" is used by some providers.
+	server.respond(http.StatusOK, `{"device_code":"dc","user_code":"UC",`+
+		`"verification_url":"https://example.com/device","expires_in":600}`)
+	service := server.service()
+	service.Scope = "profile"
+
+	if _, err := service.GetDeviceCode(); err == nil {
+		t.Error("Missing DeviceAuthorizationURL accepted")
+	}
+
+	service.DeviceAuthorizationURL = *parseURL(t, server.URL+"/device")
+	auth, err := service.GetDeviceCode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.DeviceCode != "dc" || auth.UserCode != "UC" ||
+		auth.VerificationURI != "https://example.com/device" {
+		t.Errorf("DeviceAuthorization = %+v", auth)
+	}
+	if auth.Interval != 5 {
+		t.Errorf("Interval = %d, want default 5", auth.Interval)
+	}
+	if until := time.Until(auth.ExpirationTime); until <= 0 ||
+		until > 600*time.Second {
+		t.Errorf("ExpirationTime = %v", auth.ExpirationTime)
+	}
+	r := server.last(t)
+	if r.URL.Path != "/device" || r.PostForm.Get("scope") != "profile" ||
+		r.PostForm.Get("client_id") != "client" {
+		t.Errorf("Request = %v %v", r.URL.Path, r.PostForm)
+	}
+}
+
+// deviceTokenServer responds to polls with errors, then with token.
+func deviceTokenServer(t *testing.T, errorCodes ...string) *tokenServer {
+	server := newTokenServer(t)
+	for _, code := range errorCodes {
+		server.queue(http.StatusBadRequest, `{"error":"`+code+`"}`)
+	}
+	return server
+}
+
+func TestGetAccessTokenDevice(t *testing.T) {
+	server := deviceTokenServer(t, ErrorAuthorizationPending)
+	service := server.service()
+	auth := &DeviceAuthorization{DeviceCode: "dc", Interval: 1,
+		ExpirationTime: time.Now().Add(time.Minute)}
+
+	token, err := service.GetAccessTokenDevice(auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q", token.AccessToken)
+	}
+	if server.count() != 2 {
+		t.Errorf("Polled %d times, want 2", server.count())
+	}
+	form := server.last(t).PostForm
+	if form.Get("grant_type") != GrantTypeDeviceCode ||
+		form.Get("device_code") != "dc" {
+		t.Errorf("Form = %v", form)
+	}
+}
+
+func TestGetAccessTokenDeviceSlowDown(t *testing.T) {
+	server := deviceTokenServer(t, ErrorSlowDown)
+	service := server.service()
+	auth := &DeviceAuthorization{DeviceCode: "dc", Interval: 1,
+		ExpirationTime: time.Now().Add(5 * time.Second)}
+
+	// http://tools.ietf.org/html/rfc8628#section-3.5
+	// After slow_down the interval is 6 seconds, so the device code
+	// expires before the second poll.
+	if _, err := service.GetAccessTokenDevice(auth); err == nil {
+		t.Fatal("Expired device code accepted")
+	}
+	if server.count() != 1 {
+		t.Errorf("Polled %d times, want 1", server.count())
+	}
+}
+
+func TestGetAccessTokenDeviceContext(t *testing.T) {
+	server := deviceTokenServer(t)
+	service := server.service()
+	auth := &DeviceAuthorization{DeviceCode: "dc", Interval: 5}
+
+	// Polling stops while waiting for the next poll.
+	ctx, cancel := context.WithTimeout(context.Background(),
+		100*time.Millisecond)
+	defer cancel()
+	_, err := service.GetAccessTokenDeviceContext(ctx, auth)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Error = %v, want context.DeadlineExceeded", err)
+	}
+	if server.count() != 0 {
+		t.Errorf("Polled %d times, want 0", server.count())
+	}
+}
+
+func TestGetAccessTokenDeviceDenied(t *testing.T) {
+	server := deviceTokenServer(t, ErrorAccessDenied)
+	service := server.service()
+	auth := &DeviceAuthorization{DeviceCode: "dc", Interval: 1}
+
+	_, err := service.GetAccessTokenDevice(auth)
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) ||
+		tokenError.ErrorCode != ErrorAccessDenied {
+		t.Fatalf("Error = %v, want %v", err, ErrorAccessDenied)
+	}
+}
+
+func TestGetAccessTokenDeviceExpired(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	auth := &DeviceAuthorization{DeviceCode: "dc", Interval: 5,
+		ExpirationTime: time.Now().Add(time.Second)}
+
+	if _, err := service.GetAccessTokenDevice(auth); err == nil {
+		t.Fatal("Expired device code accepted")
+	}
+	if server.count() != 0 {
+		t.Errorf("Polled %d times, want 0", server.count())
+	}
+}
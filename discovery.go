@@ -0,0 +1,272 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc8414
+Spec: http://openid.net/specs/openid-connect-discovery-1_0.html
+*/
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ServerMetadata represents Authorization Server Metadata.
+type ServerMetadata struct {
+	// http://tools.ietf.org/html/rfc8414#section-2
+
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	RegistrationEndpoint  string `json:"registration_endpoint"`
+
+	ScopesSupported        []string `json:"scopes_supported"`
+	ResponseTypesSupported []string `json:"response_types_supported"`
+	ResponseModesSupported []string `json:"response_modes_supported"`
+	GrantTypesSupported    []string `json:"grant_types_supported"`
+
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+
+	RevocationEndpoint    string `json:"revocation_endpoint"`
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+
+	// http://tools.ietf.org/html/rfc8628#section-4
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+
+	// http://tools.ietf.org/html/rfc9126#section-5
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint"`
+	RequirePushedAuthorizationRequests bool   `json:"require_pushed_authorization_requests"`
+
+	// http://tools.ietf.org/html/rfc9207#section-3
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+
+	// http://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+	SubjectTypesSupported            []string `json:"subject_types_supported"`
+	ClaimsSupported                  []string `json:"claims_supported"`
+}
+
+// Well-known URI suffixes tried by Discover, in order.
+var wellKnownSuffixes = []string{
+	"/.well-known/oauth-authorization-server",
+	"/.well-known/openid-configuration",
+}
+
+// SupportsGrantType returns true if the server supports grantType.
+func (md *ServerMetadata) SupportsGrantType(grantType string) bool {
+	grants := md.GrantTypesSupported
+	if len(grants) == 0 {
+		// Default value when omitted.
+		grants = []string{"authorization_code", "implicit"}
+	}
+	return contains(grants, grantType)
+}
+
+// SupportsAuthMethod returns true if the server supports token endpoint
+// client authentication method, like "client_secret_basic".
+func (md *ServerMetadata) SupportsAuthMethod(method string) bool {
+	methods := md.TokenEndpointAuthMethodsSupported
+	if len(methods) == 0 {
+		// Default value when omitted.
+		methods = []string{"client_secret_basic"}
+	}
+	return contains(methods, method)
+}
+
+// SupportsPKCEMethod returns true if the server advertises support for
+// PKCE code challenge method.
+func (md *ServerMetadata) SupportsPKCEMethod(method string) bool {
+	return contains(md.CodeChallengeMethodsSupported, method)
+}
+
+// Discover initializes service with endpoints from authorization server
+// metadata published by issuer.
+//
+//	service, err := oauth2.Discover("https://accounts.google.com",
+//		YOUR_CLIENT_ID, YOUR_CLIENT_SECRET)
+func Discover(issuer, clientId, clientSecret string) (
+	*OAuth2Service, error) {
+	return DiscoverContext(context.Background(), nil, issuer,
+		clientId, clientSecret)
+}
+
+// DiscoverContext is like Discover but uses ctx and client for the
+// request. Service uses client for later requests. Nil client means
+// http.DefaultClient.
+func DiscoverContext(ctx context.Context, client *http.Client,
+	issuer, clientId, clientSecret string) (*OAuth2Service, error) {
+	md, err := FetchMetadata(ctx, client, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	service := newService(clientId, clientSecret)
+	service.Client = client
+	if err := service.setMetadata(md); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// FetchMetadata gets authorization server metadata from the well-known
+// location of issuer, trying OAuth 2.0 and OpenID Connect locations.
+// Metadata issuer must be identical to issuer.
+func FetchMetadata(ctx context.Context, client *http.Client,
+	issuer string) (*ServerMetadata, error) {
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, fmt.Errorf("Issuer error: %v", err)
+	}
+	if issuerURL.Scheme == "" || issuerURL.Host == "" ||
+		issuerURL.RawQuery != "" || issuerURL.Fragment != "" {
+		return nil, fmt.Errorf("Invalid issuer: %v", issuer)
+	}
+
+	var lastErr error
+	for _, suffix := range wellKnownSuffixes {
+		md, err := fetchMetadata(ctx, client,
+			wellKnownURL(issuerURL, suffix))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		// http://tools.ietf.org/html/rfc8414#section-3.3
+		if md.Issuer != issuer {
+			return nil, fmt.Errorf("Issuer mismatch, expected: %v, got: %v",
+				issuer, md.Issuer)
+		}
+		return md, nil
+	}
+	return nil, lastErr
+}
+
+// wellKnownURL builds metadata URL for issuer.
+func wellKnownURL(issuer *url.URL, suffix string) string {
+	u := *issuer
+	path := strings.TrimRight(u.Path, "/")
+	if suffix == "/.well-known/openid-configuration" {
+		// http://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationRequest
+		u.Path = path + suffix
+	} else {
+		// http://tools.ietf.org/html/rfc8414#section-3.1
+		// Well-known suffix is inserted between host and path.
+		u.Path = suffix + path
+	}
+	u.RawPath = ""
+	return u.String()
+}
+
+// fetchMetadata gets metadata document from location.
+func fetchMetadata(ctx context.Context, client *http.Client,
+	location string) (*ServerMetadata, error) {
+	resp, raw, err := fetchDocument(ctx, client, location)
+	if err != nil {
+		return nil, err
+	}
+	md := ServerMetadata{}
+	if err := json.Unmarshal(raw, &md); err != nil {
+		return nil, newParseError(resp, raw, err)
+	}
+	return &md, nil
+}
+
+// fetchDocument gets JSON document from location. It returns
+// the response with already read body.
+func fetchDocument(ctx context.Context, client *http.Client,
+	location string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, nil, &ResponseError{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       raw,
+		}
+	}
+	return resp, raw, nil
+}
+
+// setMetadata configures service endpoints from md.
+func (service *OAuth2Service) setMetadata(md *ServerMetadata) error {
+	endpoints := []struct {
+		target *url.URL
+		value  string
+		name   string
+	}{
+		{&service.AuthorizeURL, md.AuthorizationEndpoint, "authorization_endpoint"},
+		{&service.AccessTokenURL, md.TokenEndpoint, "token_endpoint"},
+		{&service.RevocationURL, md.RevocationEndpoint, "revocation_endpoint"},
+		{&service.IntrospectionURL, md.IntrospectionEndpoint, "introspection_endpoint"},
+		{&service.DeviceAuthorizationURL, md.DeviceAuthorizationEndpoint, "device_authorization_endpoint"},
+		{&service.PushedAuthorizationURL, md.PushedAuthorizationRequestEndpoint, "pushed_authorization_request_endpoint"},
+		{&service.UserInfoURL, md.UserinfoEndpoint, "userinfo_endpoint"},
+		{&service.JWKSURL, md.JWKSURI, "jwks_uri"},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.value == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint.value)
+		if err != nil {
+			return fmt.Errorf("%v error: %v", endpoint.name, err)
+		}
+		*endpoint.target = *u
+	}
+	if md.TokenEndpoint == "" && md.SupportsGrantType("authorization_code") {
+		return fmt.Errorf("Metadata is missing token_endpoint")
+	}
+
+	service.Issuer = md.Issuer
+	service.Metadata = md
+	if md.JWKSURI != "" {
+		service.KeySet = NewRemoteKeySet(md.JWKSURI, service.Client)
+	}
+
+	// Default ClientAuthBody is used only if the server supports it.
+	if !md.SupportsAuthMethod("client_secret_post") &&
+		md.SupportsAuthMethod("client_secret_basic") {
+		service.ClientAuth = ClientAuthBasic
+	}
+	return nil
+}
+
+// contains returns true if value is in values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// metadataServer serves metadata document of issuer with "/tenant" path
+// at location. Issuer in the document is changed by issuerSuffix.
+func metadataServer(t *testing.T, location,
+	issuerSuffix string) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		if r.URL.Path != location {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer":"%[1]v/tenant%[2]v",`+
+			`"authorization_endpoint":"%[1]v/authorize",`+
+			`"token_endpoint":"%[1]v/token",`+
+			`"revocation_endpoint":"%[1]v/revoke",`+
+			`"jwks_uri":"%[1]v/jwks",`+
+			`"token_endpoint_auth_methods_supported":["client_secret_basic"],`+
+			`"code_challenge_methods_supported":["S256"]}`,
+			server.URL, issuerSuffix)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDiscover(t *testing.T) {
+	locations := []string{
+		// http://tools.ietf.org/html/rfc8414#section-3.1
+		"/.well-known/oauth-authorization-server/tenant",
+		// OpenID Connect Discovery 1.0, section 4
+		"/tenant/.well-known/openid-configuration",
+	}
+	for _, location := range locations {
+		server := metadataServer(t, location, "")
+		service, err := Discover(server.URL+"/tenant", "client", "secret")
+		if err != nil {
+			t.Fatalf("%v: %v", location, err)
+		}
+		if service.Issuer != server.URL+"/tenant" ||
+			service.AuthorizeURL.String() != server.URL+"/authorize" ||
+			service.AccessTokenURL.String() != server.URL+"/token" ||
+			service.RevocationURL.String() != server.URL+"/revoke" ||
+			service.JWKSURL.String() != server.URL+"/jwks" {
+			t.Errorf("%v: Config = %+v", location, service.Config)
+		}
+		if service.KeySet == nil {
+			t.Errorf("%v: KeySet not set", location)
+		}
+		// Server supports only client_secret_basic.
+		if service.ClientAuth != ClientAuthBasic {
+			t.Errorf("%v: ClientAuth = %#v", location, service.ClientAuth)
+		}
+		if !service.Metadata.SupportsPKCEMethod(PKCEMethodS256) {
+			t.Errorf("%v: S256 not supported", location)
+		}
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	// http://tools.ietf.org/html/rfc8414#section-3.3
+	server := metadataServer(t, "/tenant/.well-known/openid-configuration",
+		"/other")
+	if _, err := Discover(server.URL+"/tenant", "client", ""); err == nil {
+		t.Fatal("Metadata of other issuer accepted")
+	}
+}
+
+func TestDiscoverInvalidIssuer(t *testing.T) {
+	for _, issuer := range []string{"example.com", "https://example.com?a=b",
+		"https://example.com#a"} {
+		if _, err := Discover(issuer, "client", ""); err == nil {
+			t.Errorf("Issuer %q accepted", issuer)
+		}
+	}
+}
+
+func TestServerMetadataDefaults(t *testing.T) {
+	// http://tools.ietf.org/html/rfc8414#section-2
+	md := &ServerMetadata{}
+	if !md.SupportsGrantType("authorization_code") ||
+		md.SupportsGrantType("client_credentials") {
+		t.Error("Default grant types are authorization_code and implicit")
+	}
+	if !md.SupportsAuthMethod("client_secret_basic") ||
+		md.SupportsAuthMethod("client_secret_post") {
+		t.Error("Default auth method is client_secret_basic")
+	}
+	if md.SupportsPKCEMethod(PKCEMethodS256) {
+		t.Error("PKCE is not supported by default")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// Error codes returned in TokenError.ErrorCode.
+const (
+	// http://tools.ietf.org/html/rfc6749#section-5.2
+	ErrorInvalidRequest       = "invalid_request"
+	ErrorInvalidClient        = "invalid_client"
+	ErrorInvalidGrant         = "invalid_grant"
+	ErrorUnauthorizedClient   = "unauthorized_client"
+	ErrorUnsupportedGrantType = "unsupported_grant_type"
+	ErrorInvalidScope         = "invalid_scope"
+
+	// http://tools.ietf.org/html/rfc6749#section-4.1.2.1
+	ErrorAccessDenied            = "access_denied"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorServerError             = "server_error"
+	ErrorTemporarilyUnavailable  = "temporarily_unavailable"
+
+	// http://tools.ietf.org/html/rfc8628#section-3.5
+	ErrorAuthorizationPending = "authorization_pending"
+	ErrorSlowDown             = "slow_down"
+	ErrorExpiredToken         = "expired_token"
+
+	// http://tools.ietf.org/html/rfc7009#section-2.2.1
+	ErrorUnsupportedTokenType = "unsupported_token_type"
+
+	// http://tools.ietf.org/html/rfc8693#section-2.2.2
+	ErrorInvalidTarget = "invalid_target"
+)
+
+// Error implements error interface.
+func (tokenError *TokenError) Error() string {
+	msg := "Token request error: " + tokenError.ErrorCode
+	if tokenError.Description != "" {
+		msg += ", description: " + tokenError.Description
+	}
+	if tokenError.URI != "" {
+		msg += ", URI: " + tokenError.URI
+	}
+	return msg
+}
+
+// ResponseError is returned when the authorization server response
+// doesn't contain expected data nor an error code, for example on
+// non-2xx responses from proxies.
+type ResponseError struct {
+	// HTTP status code of the response
+	StatusCode int
+
+	// HTTP response headers
+	Header http.Header
+
+	// Raw response body
+	Body []byte
+}
+
+// Error implements error interface.
+func (respError *ResponseError) Error() string {
+	if respError.StatusCode/100 == 2 {
+		return "No access token found in response"
+	}
+	return fmt.Sprintf("Unexpected response status: %v %v",
+		respError.StatusCode, http.StatusText(respError.StatusCode))
+}
+
+// ParseError is returned when the authorization server response body
+// can't be decoded.
+type ParseError struct {
+	// HTTP status code of the response
+	StatusCode int
+
+	// HTTP response headers
+	Header http.Header
+
+	// Raw response body
+	Body []byte
+
+	// Decoding error
+	Err error
+}
+
+// Error implements error interface.
+func (parseError *ParseError) Error() string {
+	return fmt.Sprintf("Can't parse response (status: %v): %v",
+		parseError.StatusCode, parseError.Err)
+}
+
+// Unwrap returns decoding error.
+func (parseError *ParseError) Unwrap() error {
+	return parseError.Err
+}
+
+// newParseError returns error for the response body that failed
+// to decode. Non-2xx responses are reported as ResponseError.
+func newParseError(resp *http.Response, raw []byte, err error) error {
+	if resp.StatusCode/100 != 2 {
+		return newResponseError(resp, raw)
+	}
+	return &ParseError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       raw,
+		Err:        err,
+	}
+}
+
+// newResponseError returns *TokenError if the response contains error
+// code, *ResponseError otherwise.
+func newResponseError(resp *http.Response, raw []byte) error {
+	content, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	tokenError, err := parseTokenError(content, raw)
+	if err == nil && tokenError.ErrorCode != "" {
+		tokenError.StatusCode = resp.StatusCode
+		tokenError.Header = resp.Header
+		tokenError.Body = raw
+		return tokenError
+	}
+	return &ResponseError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       raw,
+	}
+}
+
+// parseTokenError parses error response body.
+func parseTokenError(content string, raw []byte) (*TokenError, error) {
+	tokenError := TokenError{}
+	switch content {
+	case "application/x-www-form-urlencoded", "text/plain", "text/html":
+		vals, err := url.ParseQuery(string(raw))
+		if err != nil {
+			return nil, err
+		}
+		tokenError.ErrorCode = vals.Get("error")
+		tokenError.Description = vals.Get("error_description")
+		tokenError.URI = vals.Get("error_uri")
+		tokenError.State = vals.Get("state")
+	default:
+		if err := json.Unmarshal(raw, &tokenError); err != nil {
+			return nil, err
+		}
+	}
+	return &tokenError, nil
+}
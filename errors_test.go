@@ -0,0 +1,81 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestTokenError(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+	}{
+		{"application/json", `{"error":"invalid_grant",` +
+			`"error_description":"Code expired",` +
+			`"error_uri":"https://example.com/e"}`},
+		{"application/x-www-form-urlencoded", "error=invalid_grant&" +
+			"error_description=Code+expired&error_uri=https://example.com/e"},
+	}
+	for _, test := range tests {
+		service := staticServer(t, http.StatusBadRequest, test.contentType,
+			test.body)
+		_, err := service.GetAccessToken("code")
+		var tokenError *TokenError
+		if !errors.As(err, &tokenError) {
+			t.Fatalf("%v: error = %#v, want *TokenError", test.contentType,
+				err)
+		}
+		if tokenError.ErrorCode != ErrorInvalidGrant ||
+			tokenError.Description != "Code expired" ||
+			tokenError.URI != "https://example.com/e" ||
+			tokenError.StatusCode != http.StatusBadRequest ||
+			string(tokenError.Body) != test.body {
+			t.Errorf("%v: TokenError = %+v", test.contentType, tokenError)
+		}
+		want := "Token request error: invalid_grant, description: " +
+			"Code expired, URI: https://example.com/e"
+		if err.Error() != want {
+			t.Errorf("Error() = %q, want %q", err.Error(), want)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	service := staticServer(t, http.StatusBadGateway, "text/html",
+		"<html>Bad Gateway</html>")
+	_, err := service.GetAccessToken("code")
+	var respError *ResponseError
+	if !errors.As(err, &respError) {
+		t.Fatalf("Error = %#v, want *ResponseError", err)
+	}
+	if respError.StatusCode != http.StatusBadGateway ||
+		string(respError.Body) != "<html>Bad Gateway</html>" ||
+		respError.Header.Get("Content-Type") != "text/html" {
+		t.Errorf("ResponseError = %+v", respError)
+	}
+
+	// Successful response without access token
+	service = staticServer(t, http.StatusOK, "application/json", `{}`)
+	_, err = service.GetAccessToken("code")
+	if !errors.As(err, &respError) || respError.StatusCode != http.StatusOK {
+		t.Fatalf("Error = %#v, want *ResponseError", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	service := staticServer(t, http.StatusOK, "application/json", `{"access`)
+	_, err := service.GetAccessToken("code")
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("Error = %#v, want *ParseError", err)
+	}
+	if parseError.Err == nil || errors.Unwrap(err) != parseError.Err {
+		t.Errorf("ParseError.Err = %v", parseError.Err)
+	}
+}
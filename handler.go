@@ -0,0 +1,321 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuthState holds values created when authorization flow starts, which
+// are needed to complete it on callback.
+type AuthState struct {
+	// Value of "state" parameter sent in the authorization request
+	State string `json:"state"`
+
+	// PKCE code verifier, empty if PKCE is not used
+	CodeVerifier string `json:"code_verifier,omitempty"`
+
+	// OpenID Connect nonce, empty if ID Token is not verified
+	Nonce string `json:"nonce,omitempty"`
+
+	// Time when the flow started
+	Created time.Time `json:"created"`
+}
+
+// StateStore keeps AuthState between the redirect to the authorization
+// server and the callback.
+type StateStore interface {
+	// Save stores state for the user agent making request r.
+	Save(w http.ResponseWriter, r *http.Request, state *AuthState) error
+
+	// Load returns stored state matching "state" parameter and removes it,
+	// so it can be used only once.
+	Load(w http.ResponseWriter, r *http.Request, state string) (
+		*AuthState, error)
+}
+
+// AuthHandler is http.Handler completing the authorization code flow.
+//
+// Request without "code" and "error" query parameters starts the flow:
+// state is saved in Store and the user agent is redirected to
+// the authorization server. Redirect back from the authorization server
+// (service.RedirectURL should point to the handler) is validated and
+// the code is exchanged for token, passed to OnToken.
+//
+//	store := &oauth2.CookieStateStore{Key: hmacKey, Secure: true}
+//	handler := service.AuthHandler(store, func(w http.ResponseWriter,
+//		r *http.Request, token *oauth2.Token) {
+//		// save token, redirect user
+//	})
+//	http.Handle("/oauth2", handler)
+type AuthHandler struct {
+	// Service used to build authorization URL and get token
+	Service *OAuth2Service
+
+	// Store keeps state between redirects, required
+	Store StateStore
+
+	// DisablePKCE turns off PKCE, by default it's used with S256 method
+	DisablePKCE bool
+
+	// IDTokenVerifier, if set, is used to verify ID Token issued with
+	// the token. Nonce is sent in the authorization request.
+	IDTokenVerifier *IDTokenVerifier
+
+	// OnToken is called with the token after successful exchange,
+	// required
+	OnToken func(w http.ResponseWriter, r *http.Request, token *Token)
+
+	// OnError is called when the flow fails, default responds with
+	// 400 Bad Request.
+	OnError func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// AuthHandler initializes AuthHandler.
+func (service *OAuth2Service) AuthHandler(store StateStore,
+	onToken func(w http.ResponseWriter, r *http.Request,
+		token *Token)) *AuthHandler {
+	return &AuthHandler{
+		Service: service,
+		Store:   store,
+		OnToken: onToken,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (handler *AuthHandler) ServeHTTP(w http.ResponseWriter,
+	r *http.Request) {
+	if handler.Service == nil || handler.Store == nil ||
+		handler.OnToken == nil {
+		http.Error(w, "Authorization handler not configured",
+			http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("code") == "" && query.Get("error") == "" {
+		handler.start(w, r)
+		return
+	}
+	handler.callback(w, r, query)
+}
+
+// start saves new state and redirects to the authorization server.
+func (handler *AuthHandler) start(w http.ResponseWriter, r *http.Request) {
+	authState, params, err := newAuthState(!handler.DisablePKCE,
+		handler.IDTokenVerifier != nil)
+	if err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+	if err := handler.Store.Save(w, r, authState); err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+	authURL, err := handler.Service.BuildAuthorizeURL(authState.State, params)
+	if err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// callback validates authorization response and exchanges code for token.
+func (handler *AuthHandler) callback(w http.ResponseWriter, r *http.Request,
+	query url.Values) {
+	authState, err := handler.Store.Load(w, r, query.Get("state"))
+	if err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+	code, err := handler.Service.ParseCallback(query, authState.State)
+	if err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+
+	token, err := handler.Service.exchangeCode(r, code,
+		authState.CodeVerifier)
+	if err != nil {
+		handler.fail(w, r, err)
+		return
+	}
+	if handler.IDTokenVerifier != nil {
+		_, err := handler.IDTokenVerifier.VerifyToken(r.Context(), token,
+			authState.Nonce)
+		if err != nil {
+			handler.fail(w, r, err)
+			return
+		}
+	}
+	handler.OnToken(w, r, token)
+}
+
+func (handler *AuthHandler) fail(w http.ResponseWriter, r *http.Request,
+	err error) {
+	if handler.OnError != nil {
+		handler.OnError(w, r, err)
+		return
+	}
+	http.Error(w, "Authorization failed: "+err.Error(), http.StatusBadRequest)
+}
+
+// newAuthState generates state (and optionally PKCE verifier and nonce)
+// for new authorization request. It returns extra authorization URL
+// parameters.
+func newAuthState(usePKCE, useNonce bool) (*AuthState, url.Values, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return nil, nil, err
+	}
+	authState := &AuthState{State: state, Created: time.Now()}
+	params := url.Values{}
+	if usePKCE {
+		pkce, err := NewPKCE(PKCEMethodS256)
+		if err != nil {
+			return nil, nil, err
+		}
+		authState.CodeVerifier = pkce.Verifier
+		params.Set("code_challenge", pkce.Challenge)
+		params.Set("code_challenge_method", pkce.Method)
+	}
+	if useNonce {
+		if authState.Nonce, err = randomString(24); err != nil {
+			return nil, nil, err
+		}
+		params.Set("nonce", authState.Nonce)
+	}
+	return authState, params, nil
+}
+
+// exchangeCode gets token for code received by request r.
+func (service *OAuth2Service) exchangeCode(r *http.Request, code,
+	codeVerifier string) (*Token, error) {
+	if codeVerifier != "" {
+		return service.GetAccessTokenPKCEContext(r.Context(), code,
+			codeVerifier)
+	}
+	return service.GetAccessTokenContext(r.Context(), code)
+}
+
+// CookieStateStore stores AuthState in an HMAC signed cookie.
+type CookieStateStore struct {
+	// HMAC-SHA256 key, at least 32 random bytes
+	Key []byte
+
+	// Cookie name, default: "oauth2_state"
+	Name string
+
+	// Cookie path, default: "/"
+	Path string
+
+	// Set Secure to true when the handler is served over HTTPS
+	Secure bool
+
+	// How long the flow can take, default: 10 minutes
+	MaxAge time.Duration
+}
+
+func (store *CookieStateStore) name() string {
+	if store.Name == "" {
+		return "oauth2_state"
+	}
+	return store.Name
+}
+
+func (store *CookieStateStore) path() string {
+	if store.Path == "" {
+		return "/"
+	}
+	return store.Path
+}
+
+func (store *CookieStateStore) maxAge() time.Duration {
+	if store.MaxAge <= 0 {
+		return 10 * time.Minute
+	}
+	return store.MaxAge
+}
+
+// Save implements StateStore.
+func (store *CookieStateStore) Save(w http.ResponseWriter, r *http.Request,
+	state *AuthState) error {
+	if len(store.Key) < 32 {
+		return fmt.Errorf("Cookie HMAC key must be at least 32 bytes long")
+	}
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(store.sign(payload))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     store.name(),
+		Value:    value,
+		Path:     store.path(),
+		MaxAge:   int(store.maxAge().Seconds()),
+		Secure:   store.Secure,
+		HttpOnly: true,
+		// Cookie must be sent with top-level redirect from
+		// the authorization server.
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Load implements StateStore.
+func (store *CookieStateStore) Load(w http.ResponseWriter, r *http.Request,
+	state string) (*AuthState, error) {
+	cookie, err := r.Cookie(store.name())
+	if err != nil {
+		return nil, fmt.Errorf("State cookie not found")
+	}
+	// Remove the cookie, state can be used only once.
+	http.SetCookie(w, &http.Cookie{
+		Name:     store.name(),
+		Path:     store.path(),
+		MaxAge:   -1,
+		Secure:   store.Secure,
+		HttpOnly: true,
+	})
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid state cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid state cookie")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, store.sign(payload)) {
+		return nil, fmt.Errorf("Invalid state cookie signature")
+	}
+
+	authState := AuthState{}
+	if err := json.Unmarshal(payload, &authState); err != nil {
+		return nil, fmt.Errorf("Invalid state cookie")
+	}
+	if time.Since(authState.Created) > store.maxAge() {
+		return nil, fmt.Errorf("State expired")
+	}
+	return &authState, nil
+}
+
+func (store *CookieStateStore) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, store.Key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,236 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// authHandlerTest runs AuthHandler against tokenServer.
+type authHandlerTest struct {
+	server  *tokenServer
+	handler *AuthHandler
+	token   *Token
+	err     error
+}
+
+func newAuthHandlerTest(t *testing.T) *authHandlerTest {
+	test := &authHandlerTest{server: newTokenServer(t)}
+	service := test.server.service()
+	service.RedirectURL = "https://app.example.com/oauth2"
+	store := &CookieStateStore{Key: []byte(strings.Repeat("k", 32))}
+	test.handler = service.AuthHandler(store, func(w http.ResponseWriter,
+		r *http.Request, token *Token) {
+		test.token = token
+		w.WriteHeader(http.StatusNoContent)
+	})
+	test.handler.OnError = func(w http.ResponseWriter, r *http.Request,
+		err error) {
+		test.err = err
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+	return test
+}
+
+// start starts the flow and returns authorization request query and
+// the state cookie.
+func (test *authHandlerTest) start(t *testing.T) (url.Values, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	test.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/oauth2", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Start status = %d: %v", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Cookies = %v", cookies)
+	}
+	return parseURL(t, rec.Header().Get("Location")).Query(), cookies[0]
+}
+
+// callback sends the redirect back from the authorization server.
+func (test *authHandlerTest) callback(query string,
+	cookie *http.Cookie) *httptest.ResponseRecorder {
+	test.token, test.err = nil, nil
+	r := httptest.NewRequest("GET", "/oauth2?"+query, nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	test.handler.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestAuthHandler(t *testing.T) {
+	test := newAuthHandlerTest(t)
+	query, cookie := test.start(t)
+	if query.Get("state") == "" || query.Get("code_challenge") == "" ||
+		query.Get("code_challenge_method") != PKCEMethodS256 ||
+		query.Get("redirect_uri") != "https://app.example.com/oauth2" {
+		t.Errorf("Authorization request = %v", query)
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode ||
+		cookie.MaxAge <= 0 {
+		t.Errorf("Cookie = %+v", cookie)
+	}
+
+	rec := test.callback("code=c1&state="+query.Get("state"), cookie)
+	if test.err != nil || test.token == nil || test.token.AccessToken != "at" {
+		t.Fatalf("Token = %v, error = %v", test.token, test.err)
+	}
+	form := test.server.last(t).PostForm
+	if form.Get("code") != "c1" || form.Get("code_verifier") == "" {
+		t.Errorf("Token request form = %v", form)
+	}
+	// State can be used only once.
+	removed := rec.Result().Cookies()
+	if len(removed) != 1 || removed[0].MaxAge >= 0 {
+		t.Errorf("State cookie not removed: %v", removed)
+	}
+}
+
+func TestAuthHandlerPKCE(t *testing.T) {
+	// PKCE is used by AuthHandler created without the constructor.
+	test := newAuthHandlerTest(t)
+	test.handler = &AuthHandler{
+		Service: test.handler.Service,
+		Store:   test.handler.Store,
+		OnToken: test.handler.OnToken,
+		OnError: test.handler.OnError,
+	}
+	query, _ := test.start(t)
+	if query.Get("code_challenge") == "" {
+		t.Errorf("Authorization request without PKCE: %v", query)
+	}
+
+	test.handler.DisablePKCE = true
+	query, cookie := test.start(t)
+	if query.Get("code_challenge") != "" {
+		t.Errorf("Authorization request with PKCE: %v", query)
+	}
+	test.callback("code=c1&state="+query.Get("state"), cookie)
+	if test.err != nil {
+		t.Fatal(test.err)
+	}
+	if form := test.server.last(t).PostForm; form["code_verifier"] != nil {
+		t.Errorf("Token request form = %v", form)
+	}
+}
+
+func TestAuthHandlerInvalidCallback(t *testing.T) {
+	test := newAuthHandlerTest(t)
+	query, cookie := test.start(t)
+	state := query.Get("state")
+
+	tampered := *cookie
+	tampered.Value = "e30" + cookie.Value[3:]
+	tests := []struct {
+		name   string
+		query  string
+		cookie *http.Cookie
+		err    error
+	}{
+		{"wrong state", "code=c1&state=other", cookie, ErrStateMismatch},
+		{"error without state", "error=access_denied", cookie,
+			ErrStateMismatch},
+		{"no cookie", "code=c1&state=" + state, nil, nil},
+		{"tampered cookie", "code=c1&state=" + state, &tampered, nil},
+	}
+	for _, tt := range tests {
+		test.callback(tt.query, tt.cookie)
+		if test.err == nil || test.token != nil ||
+			(tt.err != nil && test.err != tt.err) {
+			t.Errorf("%v: token = %v, error = %v", tt.name, test.token,
+				test.err)
+		}
+	}
+	if test.server.count() != 0 {
+		t.Errorf("Sent %d token requests, want 0", test.server.count())
+	}
+
+	rec := test.callback("error=access_denied&state="+state, cookie)
+	var tokenError *TokenError
+	if !errors.As(test.err, &tokenError) ||
+		tokenError.ErrorCode != ErrorAccessDenied ||
+		rec.Code != http.StatusBadRequest {
+		t.Errorf("Error = %v", test.err)
+	}
+}
+
+func TestAuthHandlerDefaultError(t *testing.T) {
+	test := newAuthHandlerTest(t)
+	test.handler.OnError = nil
+	rec := test.callback("code=c1&state=xyz", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAuthHandlerNotConfigured(t *testing.T) {
+	test := newAuthHandlerTest(t)
+	test.handler.OnToken = nil
+	rec := test.callback("", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Without OnToken status = %d", rec.Code)
+	}
+
+	handler := test.server.service().AuthHandler(nil,
+		func(w http.ResponseWriter, r *http.Request, token *Token) {})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/oauth2?code=c1", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Without Store status = %d", rec.Code)
+	}
+}
+
+func TestAuthHandlerIDToken(t *testing.T) {
+	test := newAuthHandlerTest(t)
+	idTest := newIDTokenTest(t)
+	test.handler.IDTokenVerifier = idTest.verifier
+	query, cookie := test.start(t)
+	if query.Get("nonce") == "" {
+		t.Fatal("Nonce not sent")
+	}
+
+	callback := func(nonce string) {
+		claims := idTest.claims()
+		claims["nonce"] = nonce
+		response, err := json.Marshal(map[string]interface{}{
+			"access_token": "at",
+			"id_token":     idTest.sign(t, claims),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		test.server.respond(http.StatusOK, string(response))
+		test.callback("code=c1&state="+query.Get("state"), cookie)
+	}
+
+	callback("other")
+	if test.err == nil || test.token != nil {
+		t.Errorf("ID Token with wrong nonce accepted")
+	}
+	callback(query.Get("nonce"))
+	if test.err != nil || test.token == nil {
+		t.Errorf("ID Token with valid nonce rejected: %v", test.err)
+	}
+}
+
+func TestCookieStateStoreShortKey(t *testing.T) {
+	store := &CookieStateStore{Key: []byte("short")}
+	err := store.Save(httptest.NewRecorder(),
+		httptest.NewRequest("GET", "/", nil), &AuthState{State: "xyz"})
+	if err == nil {
+		t.Fatal("Short HMAC key accepted")
+	}
+}
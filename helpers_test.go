@@ -0,0 +1,208 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testTokenResponse is a successful token response sent by tokenServer.
+const testTokenResponse = `{"access_token":"at","token_type":"Bearer",` +
+	`"expires_in":3600,"refresh_token":"rt"}`
+
+// tokenServer is a test authorization server responding to every request
+// with the same response, unless responses are queued. It records received
+// requests.
+type tokenServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	body     string
+	queued   []testResponse
+	requests []*http.Request
+}
+
+type testResponse struct {
+	status int
+	body   string
+}
+
+// newTokenServer starts tokenServer responding with testTokenResponse.
+// It's closed when the test ends.
+func newTokenServer(t *testing.T) *tokenServer {
+	server := &tokenServer{status: http.StatusOK, body: testTokenResponse}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serveHTTP))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *tokenServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	server.mu.Lock()
+	server.requests = append(server.requests, r)
+	status, body := server.status, server.body
+	if len(server.queued) > 0 {
+		status, body = server.queued[0].status, server.queued[0].body
+		server.queued = server.queued[1:]
+	}
+	server.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprint(w, body)
+}
+
+// respond sets response sent to following requests.
+func (server *tokenServer) respond(status int, body string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.status, server.body = status, body
+}
+
+// queue adds response sent once, before the default one.
+func (server *tokenServer) queue(status int, body string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.queued = append(server.queued, testResponse{status, body})
+}
+
+// last returns the last received request.
+func (server *tokenServer) last(t *testing.T) *http.Request {
+	t.Helper()
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.requests) == 0 {
+		t.Fatal("No request received")
+	}
+	return server.requests[len(server.requests)-1]
+}
+
+// count returns number of received requests.
+func (server *tokenServer) count() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return len(server.requests)
+}
+
+// service returns service using server endpoints.
+func (server *tokenServer) service() *OAuth2Service {
+	return Service("client", "secret", server.URL+"/authorize",
+		server.URL+"/token")
+}
+
+// staticServer responds to every request with status and body.
+func staticServer(t *testing.T, status int, contentType,
+	body string) *OAuth2Service {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return Service("client", "secret", server.URL+"/authorize",
+		server.URL+"/token")
+}
+
+// parseURL parses rawURL or fails the test.
+func parseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+// testJWTHeader holds JOSE header parameters checked by tests.
+type testJWTHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// parseTestJWT verifies JWT signed with key and returns its header and
+// claims. key is []byte for HMAC algorithms, crypto.PublicKey otherwise.
+func parseTestJWT(t *testing.T, raw string, key interface{}) (
+	testJWTHeader, map[string]interface{}) {
+	t.Helper()
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT has %d parts, want 3", len(parts))
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var header testJWTHeader
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	if !verifyTestJWS(t, header.Algorithm, key, signingInput, decoded[2]) {
+		t.Fatalf("Invalid %v signature", header.Algorithm)
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(decoded[1], &claims); err != nil {
+		t.Fatal(err)
+	}
+	return header, claims
+}
+
+// verifyTestJWS checks JWS signature using crypto packages directly.
+func verifyTestJWS(t *testing.T, alg string, key interface{},
+	signingInput, signature []byte) bool {
+	t.Helper()
+	hash, err := algorithmHash(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg == EdDSA {
+		pub, ok := key.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, signingInput, signature)
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, key)
+		mac.Write(signingInput)
+		return strings.HasPrefix(alg, "HS") && hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(key, hash, digest, signature,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+		return strings.HasPrefix(alg, "RS") &&
+			rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return strings.HasPrefix(alg, "ES") && ecdsa.Verify(key, digest, r, s)
+	}
+	t.Fatalf("Unsupported key type: %T", key)
+	return false
+}
@@ -0,0 +1,227 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7662
+*/
+
+package oauth2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Introspection represents a Token Introspection Response.
+type Introspection struct {
+	// http://tools.ietf.org/html/rfc7662#section-2.2
+
+	// Whether or not the presented token is currently active.
+	Active bool `json:"active"`
+
+	// A space-separated list of scopes associated with this token.
+	Scope string `json:"scope,omitempty"`
+
+	// Client identifier for the client that requested this token.
+	ClientId string `json:"client_id,omitempty"`
+
+	// Human-readable identifier for the resource owner who
+	// authorized this token.
+	Username string `json:"username,omitempty"`
+
+	// Type of the token.
+	TokenType string `json:"token_type,omitempty"`
+
+	// Seconds since epoch when this token will expire.
+	Exp int64 `json:"exp,omitempty"`
+
+	// Seconds since epoch when this token was issued.
+	Iat int64 `json:"iat,omitempty"`
+
+	// Seconds since epoch when this token is not to be used before.
+	Nbf int64 `json:"nbf,omitempty"`
+
+	// Subject of the token, usually resource owner identifier.
+	Sub string `json:"sub,omitempty"`
+
+	// Intended audience for this token.
+	Aud Audience `json:"aud,omitempty"`
+
+	// Issuer of this token.
+	Iss string `json:"iss,omitempty"`
+
+	// Identifier for the token.
+	Jti string `json:"jti,omitempty"`
+
+	// Extra holds other claims returned by the server.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// introspectionMembers lists response members with Introspection fields.
+var introspectionMembers = []string{"active", "scope", "client_id",
+	"username", "token_type", "exp", "iat", "nbf", "sub", "aud", "iss", "jti"}
+
+// ExpirationTime returns the expiration time of the token, zero if unknown.
+func (in *Introspection) ExpirationTime() time.Time {
+	if in.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(in.Exp, 0)
+}
+
+// Introspect asks the authorization server about the state of token.
+// tokenTypeHint is optional. Inactive tokens are reported with Active
+// set to false, not as an error.
+//
+// If service.IntrospectionCache is set, active responses are cached
+// until token expiration.
+func (service *OAuth2Service) Introspect(token, tokenTypeHint string) (
+	*Introspection, error) {
+	return service.IntrospectContext(context.Background(), token,
+		tokenTypeHint)
+}
+
+// IntrospectContext is like Introspect but uses ctx for the request.
+func (service *OAuth2Service) IntrospectContext(ctx context.Context,
+	token, tokenTypeHint string) (*Introspection, error) {
+	// http://tools.ietf.org/html/rfc7662#section-2.1
+	if service.IntrospectionURL.String() == "" {
+		return nil, fmt.Errorf("Introspection URL not configured")
+	}
+	if len(token) == 0 {
+		return nil, fmt.Errorf("Token can't be empty")
+	}
+	if cached := service.IntrospectionCache.get(token); cached != nil {
+		return cached, nil
+	}
+
+	params := url.Values{}
+	params.Set("token", token)
+	(*MyUrlValues)(&params).CheckAndSet("token_type_hint", tokenTypeHint)
+
+	resp, raw, err := service.postForm(ctx, service.IntrospectionURL.String(),
+		params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newResponseError(resp, raw)
+	}
+
+	in := Introspection{}
+	if err := json.Unmarshal(raw, &in); err != nil {
+		return nil, newParseError(resp, raw, err)
+	}
+	if err := json.Unmarshal(raw, &in.Extra); err != nil {
+		return nil, newParseError(resp, raw, err)
+	}
+	for _, name := range introspectionMembers {
+		delete(in.Extra, name)
+	}
+
+	service.IntrospectionCache.put(token, &in)
+	return &in, nil
+}
+
+// IntrospectionCache stores active introspection responses until
+// the token expires. Zero value is ready to use. It's safe for concurrent
+// use.
+//
+//	service.IntrospectionCache = oauth2.NewIntrospectionCache()
+type IntrospectionCache struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*Introspection
+}
+
+// NewIntrospectionCache initializes empty IntrospectionCache.
+func NewIntrospectionCache() *IntrospectionCache {
+	return &IntrospectionCache{
+		entries: make(map[[sha256.Size]byte]*Introspection),
+	}
+}
+
+// get returns cached response for token, nil if not found or expired.
+func (cache *IntrospectionCache) get(token string) *Introspection {
+	if cache == nil {
+		return nil
+	}
+	key := sha256.Sum256([]byte(token))
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	in, ok := cache.entries[key]
+	if !ok {
+		return nil
+	}
+	if !in.ExpirationTime().After(time.Now()) {
+		delete(cache.entries, key)
+		return nil
+	}
+	return in.clone()
+}
+
+// put stores active response with known expiration time.
+func (cache *IntrospectionCache) put(token string, in *Introspection) {
+	if cache == nil || !in.Active || in.Exp == 0 {
+		return
+	}
+	now := time.Now()
+	if !in.ExpirationTime().After(now) {
+		return
+	}
+	key := sha256.Sum256([]byte(token))
+	copied := in.clone()
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.entries == nil {
+		cache.entries = make(map[[sha256.Size]byte]*Introspection)
+	}
+	// Drop expired entries so the cache doesn't grow without limit.
+	for k, entry := range cache.entries {
+		if !entry.ExpirationTime().After(now) {
+			delete(cache.entries, k)
+		}
+	}
+	cache.entries[key] = copied
+}
+
+// clone returns a deep copy of in, so cached responses aren't shared
+// with callers.
+func (in *Introspection) clone() *Introspection {
+	copied := *in
+	if in.Aud != nil {
+		copied.Aud = append(Audience(nil), in.Aud...)
+	}
+	if in.Extra != nil {
+		copied.Extra = cloneJSONValue(in.Extra).(map[string]interface{})
+	}
+	return &copied
+}
+
+// cloneJSONValue deep copies value decoded from JSON.
+func cloneJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			copied[k] = cloneJSONValue(v)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, v := range value {
+			copied[i] = cloneJSONValue(v)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,103 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// introspectionServer responds with active token introspection response.
+func introspectionServer(t *testing.T) (*tokenServer, *OAuth2Service) {
+	server := newTokenServer(t)
+	server.respond(http.StatusOK, fmt.Sprintf(`{"active":true,`+
+		`"scope":"read write","client_id":"client","sub":"user",`+
+		`"aud":["api","other"],"exp":%d,"tenant":{"id":"t1"}}`,
+		time.Now().Add(time.Hour).Unix()))
+	service := server.service()
+	service.IntrospectionURL = *parseURL(t, server.URL+"/introspect")
+	return server, service
+}
+
+func TestIntrospect(t *testing.T) {
+	server, service := introspectionServer(t)
+	in, err := service.Introspect("at", TokenTypeHintAccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !in.Active || in.Scope != "read write" || in.Sub != "user" ||
+		!in.Aud.Contains("other") || in.ExpirationTime().IsZero() {
+		t.Errorf("Introspection = %+v", in)
+	}
+	// Only members without Introspection fields are in Extra.
+	if len(in.Extra) != 1 || in.Extra["tenant"] == nil {
+		t.Errorf("Extra = %v", in.Extra)
+	}
+	form := server.last(t).PostForm
+	if form.Get("token") != "at" ||
+		form.Get("token_type_hint") != TokenTypeHintAccessToken {
+		t.Errorf("Form = %v", form)
+	}
+}
+
+func TestIntrospectInactive(t *testing.T) {
+	server, service := introspectionServer(t)
+	server.respond(http.StatusOK, `{"active":false}`)
+	service.IntrospectionCache = NewIntrospectionCache()
+	for i := 0; i < 2; i++ {
+		in, err := service.Introspect("at", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if in.Active {
+			t.Error("Inactive token reported as active")
+		}
+	}
+	if server.count() != 2 {
+		t.Errorf("Sent %d requests, inactive response must not be cached",
+			server.count())
+	}
+}
+
+func TestIntrospectionCache(t *testing.T) {
+	server, service := introspectionServer(t)
+	// Zero value is ready to use.
+	service.IntrospectionCache = &IntrospectionCache{}
+
+	first, err := service.Introspect("at", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes made by callers don't affect cached response.
+	first.Aud[0] = "changed"
+	first.Extra["tenant"].(map[string]interface{})["id"] = "changed"
+	delete(first.Extra, "tenant")
+
+	second, err := service.Introspect("at", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.count() != 1 {
+		t.Errorf("Sent %d requests, want 1", server.count())
+	}
+	if second.Aud[0] != "api" {
+		t.Errorf("Aud = %v", second.Aud)
+	}
+	tenant, _ := second.Extra["tenant"].(map[string]interface{})
+	if tenant["id"] != "t1" {
+		t.Errorf("Extra = %v", second.Extra)
+	}
+
+	if _, err := service.Introspect("other", ""); err != nil {
+		t.Fatal(err)
+	}
+	if server.count() != 2 {
+		t.Errorf("Sent %d requests, want 2", server.count())
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc9101
+Spec: http://tools.ietf.org/html/rfc7516
+*/
+
+package oauth2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/url"
+	"time"
+)
+
+// JWE algorithms used to encrypt request objects.
+const (
+	RSAOAEP256 = "RSA-OAEP-256"
+	A256GCM    = "A256GCM"
+)
+
+// RequestObject configures JWT-Secured Authorization Requests. When set
+// on OAuth2Service, authorization URLs and pushed authorization requests
+// carry authorization request parameters in a signed (and optionally
+// encrypted) JWT.
+type RequestObject struct {
+	// Key signing the request object
+	JWTSigner
+
+	// Authorization server RSA public key, if set the request object is
+	// encrypted using RSA-OAEP-256 and A256GCM
+	EncryptionKey *rsa.PublicKey
+
+	// Key ID of EncryptionKey
+	EncryptionKeyID string
+
+	// Host, if set, publishes the request object and returns its URI,
+	// which is passed in "request_uri" instead of "request" parameter.
+	Host func(requestObject string) (requestURI string, err error)
+}
+
+// BuildAuthorizeURL is like GetAuthorizeURLParams but returns an error
+// when building the request object fails.
+//
+//	service.RequestObject = &oauth2.RequestObject{
+//		JWTSigner: oauth2.JWTSigner{Key: key, KeyID: "k1"},
+//	}
+//	authURL, err := service.BuildAuthorizeURL(state, nil)
+func (service *OAuth2Service) BuildAuthorizeURL(state string,
+	extra url.Values) (string, error) {
+	params := service.authorizeParams(state, extra)
+	if service.RequestObject == nil {
+		return service.authorizeURL(params), nil
+	}
+	requestObject, err := service.RequestObject.build(service.Config, params)
+	if err != nil {
+		return "", err
+	}
+
+	// http://tools.ietf.org/html/rfc9101#section-5
+	// "client_id" must be sent outside the request object, OpenID
+	// Connect also requires "response_type" and "scope".
+	authParams := url.Values{}
+	authParams.Set("client_id", service.ClientId)
+	authParams.Set("response_type", service.ResponseType)
+	(*MyUrlValues)(&authParams).CheckAndSet("scope", service.Scope)
+	if service.RequestObject.Host != nil {
+		requestURI, err := service.RequestObject.Host(requestObject)
+		if err != nil {
+			return "", err
+		}
+		authParams.Set("request_uri", requestURI)
+	} else {
+		authParams.Set("request", requestObject)
+	}
+	return service.authorizeURL(authParams), nil
+}
+
+// build returns the request object containing params.
+// http://tools.ietf.org/html/rfc9101#section-4
+func (object *RequestObject) build(config *Config, params url.Values) (
+	string, error) {
+	jti, err := newJWTID()
+	if err != nil {
+		return "", err
+	}
+
+	claims := map[string]interface{}{}
+	for key, values := range params {
+		if len(values) == 1 {
+			claims[key] = values[0]
+		} else {
+			claims[key] = values
+		}
+	}
+	audience := config.Issuer
+	if audience == "" {
+		audience = config.AuthorizeURL.String()
+	}
+	now := time.Now()
+	claims["iss"] = config.ClientId
+	claims["aud"] = audience
+	claims["jti"] = jti
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(object.lifetime()).Unix()
+
+	header := map[string]interface{}{"typ": "oauth-authz-req+jwt"}
+	signed, err := object.sign(header, claims)
+	if err != nil {
+		return "", err
+	}
+	if object.EncryptionKey == nil {
+		return signed, nil
+	}
+	// http://tools.ietf.org/html/rfc9101#section-6.1
+	return encryptJWE(object.EncryptionKey, object.EncryptionKeyID,
+		[]byte(signed))
+}
+
+// encryptJWE encrypts nested JWT as a compact JWE using RSA-OAEP-256 and
+// A256GCM.
+// http://tools.ietf.org/html/rfc7516#section-5.1
+func encryptJWE(key *rsa.PublicKey, kid string, plaintext []byte) (
+	string, error) {
+	header := map[string]interface{}{
+		"alg": RSAOAEP256,
+		"enc": A256GCM,
+		"cty": "JWT",
+	}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	rawHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(rawHeader)
+
+	cek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, cek); err != nil {
+		return "", err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, key,
+		cek, nil)
+	if err != nil {
+		return "", err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	// Protected header is the additional authenticated data.
+	sealed := aead.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()],
+		sealed[len(sealed)-aead.Overhead():]
+
+	enc := base64.RawURLEncoding.EncodeToString
+	return protected + "." + enc(encryptedKey) + "." + enc(iv) + "." +
+		enc(ciphertext) + "." + enc(tag), nil
+}
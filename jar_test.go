@@ -0,0 +1,202 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// jarService returns service sending request objects signed with
+// returned key.
+func jarService(t *testing.T) (*OAuth2Service, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := Service("client", "secret", "https://as.example.com/authorize",
+		"https://as.example.com/token")
+	service.Issuer = "https://as.example.com"
+	service.Scope = "openid"
+	service.RedirectURL = "https://app.example.com/callback"
+	service.RequestObject = &RequestObject{
+		JWTSigner: JWTSigner{Key: key, KeyID: "k1"},
+	}
+	return service, key
+}
+
+func TestBuildAuthorizeURL(t *testing.T) {
+	service, key := jarService(t)
+	authURL, err := service.BuildAuthorizeURL("state", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parseURL(t, authURL).Query()
+	if len(query) != 4 || query.Get("client_id") != "client" ||
+		query.Get("response_type") != "code" ||
+		query.Get("scope") != "openid" || query.Get("request") == "" {
+		t.Fatalf("Query = %v", query)
+	}
+
+	header, claims := parseTestJWT(t, query.Get("request"), key.Public())
+	if header.Type != "oauth-authz-req+jwt" || header.KeyID != "k1" {
+		t.Errorf("Header = %+v", header)
+	}
+	if claims["iss"] != "client" || claims["aud"] != "https://as.example.com" ||
+		claims["state"] != "state" || claims["client_id"] != "client" ||
+		claims["redirect_uri"] != "https://app.example.com/callback" {
+		t.Errorf("Claims = %v", claims)
+	}
+
+	// Parameters of GetAuthorizeURL are in the request object too.
+	query = parseURL(t, service.GetAuthorizeURL("state")).Query()
+	if query.Get("request") == "" || query.Get("state") != "" {
+		t.Errorf("GetAuthorizeURL() query = %v", query)
+	}
+	pkce, err := NewPKCE(PKCEMethodS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query = parseURL(t, service.GetAuthorizeURLPKCE("state", pkce)).Query()
+	_, claims = parseTestJWT(t, query.Get("request"), key.Public())
+	if query.Get("code_challenge") != "" ||
+		claims["code_challenge"] != pkce.Challenge {
+		t.Errorf("GetAuthorizeURLPKCE() query = %v, claims = %v", query,
+			claims)
+	}
+
+	service.RequestObject = nil
+	authURL, err = service.BuildAuthorizeURL("state", nil)
+	if err != nil || authURL != service.GetAuthorizeURL("state") {
+		t.Errorf("BuildAuthorizeURL() = %v, %v", authURL, err)
+	}
+}
+
+func TestBuildAuthorizeURLHost(t *testing.T) {
+	service, _ := jarService(t)
+	var hosted string
+	service.RequestObject.Host = func(requestObject string) (string, error) {
+		hosted = requestObject
+		return "https://app.example.com/request/1", nil
+	}
+	authURL, err := service.BuildAuthorizeURL("state", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parseURL(t, authURL).Query()
+	if query.Get("request_uri") != "https://app.example.com/request/1" ||
+		query.Get("request") != "" || hosted == "" {
+		t.Errorf("Query = %v", query)
+	}
+
+	service.RequestObject.Host = func(string) (string, error) {
+		return "", errors.New("Upload failed")
+	}
+	if _, err := service.BuildAuthorizeURL("state", nil); err == nil {
+		t.Error("Host error not returned")
+	}
+	service.RequestObject = &RequestObject{}
+	if _, err := service.BuildAuthorizeURL("state", nil); err == nil {
+		t.Error("Request object without key built")
+	}
+	// Parameters are not sent without the request object.
+	if authURL := service.GetAuthorizeURL("state"); authURL != "" {
+		t.Errorf("GetAuthorizeURL() = %v, want empty", authURL)
+	}
+}
+
+// decryptTestJWE decrypts compact JWE made by encryptJWE.
+func decryptTestJWE(t *testing.T, key *rsa.PrivateKey, raw string) (
+	map[string]interface{}, []byte) {
+	t.Helper()
+	parts := strings.Split(raw, ".")
+	if len(parts) != 5 {
+		t.Fatalf("JWE has %d parts, want 5", len(parts))
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		var err error
+		if decoded[i], err = base64.RawURLEncoding.DecodeString(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := map[string]interface{}{}
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	cek, err := rsa.DecryptOAEP(sha256.New(), nil, key, decoded[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := aead.Open(nil, decoded[2],
+		append(decoded[3], decoded[4]...), []byte(parts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header, plaintext
+}
+
+func TestBuildAuthorizeURLEncrypted(t *testing.T) {
+	service, key := jarService(t)
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.RequestObject.EncryptionKey = &encryptionKey.PublicKey
+	service.RequestObject.EncryptionKeyID = "enc1"
+	authURL, err := service.BuildAuthorizeURL("state", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, plaintext := decryptTestJWE(t, encryptionKey,
+		parseURL(t, authURL).Query().Get("request"))
+	if header["alg"] != RSAOAEP256 || header["enc"] != A256GCM ||
+		header["cty"] != "JWT" || header["kid"] != "enc1" {
+		t.Errorf("JWE header = %v", header)
+	}
+	if _, claims := parseTestJWT(t, string(plaintext), key.Public()); claims["state"] != "state" {
+		t.Errorf("Claims = %v", claims)
+	}
+}
+
+func TestPushAuthorizationRequestObject(t *testing.T) {
+	server, service := parServer(t)
+	jar, key := jarService(t)
+	service.RequestObject = jar.RequestObject
+	if _, err := service.PushAuthorizationRequest("state", nil); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	// Authorization parameters are sent only in the request object.
+	if form.Get("client_id") != "client" || form["state"] != nil ||
+		form["redirect_uri"] != nil {
+		t.Fatalf("Form = %v", form)
+	}
+	_, claims := parseTestJWT(t, form.Get("request"), key.Public())
+	if claims["state"] != "state" || claims["aud"] != server.URL+"/authorize?x=1" {
+		t.Errorf("Claims = %v", claims)
+	}
+}
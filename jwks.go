@@ -0,0 +1,394 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7517
+*/
+
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONWebKey represents a public key from JSON Web Key Set.
+type JSONWebKey struct {
+	// Key ID, "kid" parameter
+	KeyID string
+
+	// Intended algorithm, "alg" parameter, optional
+	Algorithm string
+
+	// Intended use ("sig" or "enc"), "use" parameter, optional
+	Use string
+
+	// *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey
+	Key crypto.PublicKey
+}
+
+// KeySet provides keys used to verify JWT signatures.
+type KeySet interface {
+	// VerificationKeys returns signing keys with given key ID, or all
+	// signing keys if kid is empty.
+	VerificationKeys(ctx context.Context, kid string) ([]JSONWebKey, error)
+}
+
+// jsonWebKey is the JSON representation of a public key.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses JSON Web Key Set document. Keys of unsupported types
+// or curves are skipped.
+func ParseJWKS(data []byte) ([]JSONWebKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make([]JSONWebKey, 0, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWK %q error: %v", jwk.Kid, err)
+		}
+		if key == nil {
+			continue
+		}
+		keys = append(keys, JSONWebKey{
+			KeyID:     jwk.Kid,
+			Algorithm: jwk.Alg,
+			Use:       jwk.Use,
+			Key:       key,
+		})
+	}
+	return keys, nil
+}
+
+// publicKey decodes key, returns nil key for unsupported key types and
+// curves.
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	// http://tools.ietf.org/html/rfc7518#section-6
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 2 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("Invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			// Other curves, like secp256k1, can't be used to verify
+			// tokens.
+			return nil, nil
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		// Reject points which are not on the curve.
+		size := (curve.Params().BitSize + 7) / 8
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, fmt.Errorf("Invalid EC point")
+		}
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("Invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		// http://tools.ietf.org/html/rfc8037#section-2
+		if jwk.Crv != "Ed25519" {
+			// X25519 and others are used only for key agreement.
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+// decodeBigInt decodes base64url encoded big-endian integer.
+func decodeBigInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, fmt.Errorf("Missing key parameter")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// Defaults used by RemoteKeySet.
+const (
+	// DefaultJWKSCacheTTL is how long keys are cached when the JWK Set
+	// response has no caching headers.
+	DefaultJWKSCacheTTL = time.Hour
+
+	// DefaultJWKSRefreshInterval is the minimum time between fetches.
+	DefaultJWKSRefreshInterval = 30 * time.Second
+)
+
+// RemoteKeySet gets keys from JWK Set document published by
+// the authorization server.
+//
+// Keys are cached as long as Cache-Control (or Expires) response header
+// allows. When a JWT is signed with unknown key ID the document is
+// fetched again, to handle key rotation, but not more often than
+// RefreshInterval. It's safe for concurrent use.
+type RemoteKeySet struct {
+	// JWK Set document URL
+	URL string
+
+	// Client used to fetch keys, default: http.DefaultClient
+	Client *http.Client
+
+	// CacheTTL is used when the response has no caching headers,
+	// default: DefaultJWKSCacheTTL
+	CacheTTL time.Duration
+
+	// RefreshInterval is the minimum time between fetches,
+	// default: DefaultJWKSRefreshInterval
+	RefreshInterval time.Duration
+
+	mu        sync.Mutex
+	keys      []JSONWebKey
+	expiry    time.Time
+	lastFetch time.Time
+	lastErr   error
+	inflight  *keySetFetch
+}
+
+// keySetFetch represents in-flight request for keys, shared by all
+// callers waiting for it.
+type keySetFetch struct {
+	done chan struct{}
+	keys []JSONWebKey
+	err  error
+}
+
+// NewRemoteKeySet initializes key set fetched from jwksURL.
+func NewRemoteKeySet(jwksURL string, client *http.Client) *RemoteKeySet {
+	return &RemoteKeySet{URL: jwksURL, Client: client}
+}
+
+// VerificationKeys implements KeySet.
+func (set *RemoteKeySet) VerificationKeys(ctx context.Context, kid string) (
+	[]JSONWebKey, error) {
+	set.mu.Lock()
+	now := time.Now()
+	recentlyFetched := now.Sub(set.lastFetch) < set.refreshInterval()
+	if set.keys != nil {
+		found := filterKeys(set.keys, kid)
+		if now.Before(set.expiry) && (len(found) > 0 || kid == "") {
+			set.mu.Unlock()
+			return found, nil
+		}
+		if recentlyFetched {
+			// Rate limit fetches caused by unknown key IDs.
+			set.mu.Unlock()
+			return found, nil
+		}
+	} else if set.lastErr != nil && recentlyFetched {
+		err := set.lastErr
+		set.mu.Unlock()
+		return nil, err
+	}
+
+	// Only one request is sent, other callers wait for its result.
+	fetch := set.inflight
+	if fetch == nil {
+		fetch = &keySetFetch{done: make(chan struct{})}
+		set.inflight = fetch
+		set.mu.Unlock()
+		// Request isn't cancelled when ctx of the first caller is done,
+		// its result is shared and cached. Every caller, including
+		// the first one, stops waiting when its ctx is done.
+		go set.update(context.WithoutCancel(ctx), fetch)
+	} else {
+		set.mu.Unlock()
+	}
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fetch.err != nil {
+		// Keep using known keys while the server is unavailable.
+		set.mu.Lock()
+		found := filterKeys(set.keys, kid)
+		set.mu.Unlock()
+		if len(found) > 0 {
+			return found, nil
+		}
+		return nil, fetch.err
+	}
+	return filterKeys(fetch.keys, kid), nil
+}
+
+// update fetches keys and stores result in set and fetch.
+func (set *RemoteKeySet) update(ctx context.Context, fetch *keySetFetch) {
+	keys, ttl, err := set.fetch(ctx)
+
+	set.mu.Lock()
+	now := time.Now()
+	set.lastFetch = now
+	set.lastErr = err
+	if err == nil {
+		set.keys = keys
+		set.expiry = now.Add(ttl)
+	}
+	set.inflight = nil
+	set.mu.Unlock()
+
+	fetch.keys, fetch.err = keys, err
+	close(fetch.done)
+}
+
+// fetch downloads and parses JWK Set document. It returns how long
+// keys can be cached.
+func (set *RemoteKeySet) fetch(ctx context.Context) (
+	[]JSONWebKey, time.Duration, error) {
+	if set.URL == "" {
+		return nil, 0, fmt.Errorf("JWKS URL not configured")
+	}
+	resp, raw, err := fetchDocument(ctx, set.Client, set.URL)
+	if err != nil {
+		return nil, 0, err
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return nil, 0, newParseError(resp, raw, err)
+	}
+	ttl, ok := cacheTTL(resp.Header, time.Now())
+	if !ok {
+		ttl = set.CacheTTL
+		if ttl <= 0 {
+			ttl = DefaultJWKSCacheTTL
+		}
+	}
+	return keys, ttl, nil
+}
+
+func (set *RemoteKeySet) refreshInterval() time.Duration {
+	if set.RefreshInterval <= 0 {
+		return DefaultJWKSRefreshInterval
+	}
+	return set.RefreshInterval
+}
+
+// cacheTTL returns freshness lifetime of the response from Cache-Control
+// or Expires header, ok is false if there are no caching headers.
+func cacheTTL(header http.Header, now time.Time) (
+	ttl time.Duration, ok bool) {
+	// http://tools.ietf.org/html/rfc9111#section-4.2.1
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store", directive == "no-cache":
+				return 0, true
+			case strings.HasPrefix(directive, "max-age="):
+				seconds, err := strconv.ParseInt(
+					strings.Trim(directive[len("max-age="):], `"`), 10, 64)
+				if err != nil || seconds < 0 {
+					continue
+				}
+				ttl = time.Duration(seconds) * time.Second
+				age, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+				if err == nil && age > 0 {
+					ttl -= time.Duration(age) * time.Second
+				}
+				if ttl < 0 {
+					ttl = 0
+				}
+				return ttl, true
+			}
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(now) {
+			return 0, true
+		}
+		return t.Sub(now), true
+	}
+	return 0, false
+}
+
+// filterKeys returns signing keys with given key ID, all signing keys
+// if kid is empty.
+func filterKeys(keys []JSONWebKey, kid string) []JSONWebKey {
+	var found []JSONWebKey
+	for _, key := range keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if kid == "" || key.KeyID == kid {
+			found = append(found, key)
+		}
+	}
+	return found
+}
@@ -0,0 +1,303 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testJWK returns JWK representation of public key.
+func testJWK(t *testing.T, kid string, key crypto.PublicKey) map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid,
+			"n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		x, y := make([]byte, size), make([]byte, size)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return map[string]string{"kty": "EC", "kid": kid,
+			"crv": key.Curve.Params().Name, "x": enc(x), "y": enc(y)}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519",
+			"x": enc(key)}
+	}
+	t.Fatalf("Unsupported key type %T", key)
+	return nil
+}
+
+// testJWKS returns JWK Set document with keys.
+func testJWKS(t *testing.T, keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaJWK := testJWK(t, "rsa", &rsaKey.PublicKey)
+	rsaJWK["alg"], rsaJWK["use"] = RS256, "sig"
+
+	keys, err := ParseJWKS(testJWKS(t, rsaJWK,
+		testJWK(t, "ec", &ecKey.PublicKey), testJWK(t, "ed", edKey),
+		// Keys of unsupported types are skipped.
+		map[string]string{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		map[string]string{"kty": "OKP", "kid": "x", "crv": "X25519",
+			"x": "hSDwCYkwp1R0i33ctD73Wg2_Og0mOBr066SpjqqbTmo"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("Parsed %d keys, want 3", len(keys))
+	}
+	if keys[0].KeyID != "rsa" || keys[0].Algorithm != RS256 ||
+		keys[0].Use != "sig" || !rsaKey.PublicKey.Equal(keys[0].Key) {
+		t.Errorf("RSA key = %+v", keys[0])
+	}
+	if !ecKey.PublicKey.Equal(keys[1].Key) {
+		t.Errorf("EC key = %+v", keys[1])
+	}
+	if !edKey.Equal(keys[2].Key) {
+		t.Errorf("Ed25519 key = %+v", keys[2])
+	}
+}
+
+func TestParseJWKSUnsupportedCurve(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// secp256k1 is used by some identity providers for other purposes,
+	// the key is skipped but the set is still usable.
+	keys, err := ParseJWKS(testJWKS(t,
+		map[string]string{"kty": "EC", "kid": "k256", "crv": "secp256k1",
+			"x": "WfQKjlS0_mpm6yGVjm-W8dWN-NgIWdMSEQWhwYxk1So",
+			"y": "cB0pWm8fl5TtS5T6BoZ8OJ2gDx02YJKbFVlvM4VqNWQ"},
+		testJWK(t, "p256", &ecKey.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].KeyID != "p256" {
+		t.Errorf("Keys = %+v, want only p256", keys)
+	}
+}
+
+func TestParseJWKSInvalid(t *testing.T) {
+	documents := []string{
+		`{"keys":[{"kty":"RSA","kid":"r","e":"AQAB"}]}`,
+		`{"keys":[{"kty":"EC","kid":"e","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		`{"keys":[{"kty":"OKP","kid":"d","crv":"Ed25519","x":"AQ"}]}`,
+		`{"keys":`,
+	}
+	for _, document := range documents {
+		if _, err := ParseJWKS([]byte(document)); err == nil {
+			t.Errorf("ParseJWKS(%v) succeeded", document)
+		}
+	}
+}
+
+// jwksServer serves JWK Set document which can be changed to simulate
+// key rotation.
+type jwksServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	document []byte
+	status   int
+	fetches  int
+	delay    time.Duration
+}
+
+// newJWKSServer starts jwksServer responding with document after delay.
+func newJWKSServer(t *testing.T, document []byte,
+	delay time.Duration) *jwksServer {
+	server := &jwksServer{document: document, status: http.StatusOK,
+		delay: delay}
+	server.Server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			server.mu.Lock()
+			server.fetches++
+			document, status, delay := server.document, server.status,
+				server.delay
+			server.mu.Unlock()
+
+			time.Sleep(delay)
+			w.Header().Set("Cache-Control", "public, max-age=600")
+			w.WriteHeader(status)
+			w.Write(document)
+		}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *jwksServer) set(document []byte, status int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.document, server.status = document, status
+}
+
+func (server *jwksServer) count() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.fetches
+}
+
+// newTestEd25519JWK returns JWK of a new Ed25519 key.
+func newTestEd25519JWK(t *testing.T, kid string) map[string]string {
+	key, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testJWK(t, kid, key)
+}
+
+func TestRemoteKeySetCache(t *testing.T) {
+	server := newJWKSServer(t, testJWKS(t, newTestEd25519JWK(t, "k1")),
+		20*time.Millisecond)
+	set := NewRemoteKeySet(server.URL, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := set.VerificationKeys(context.Background(), "k1")
+			if err != nil || len(keys) != 1 {
+				t.Errorf("VerificationKeys() = %v, %v", keys, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := set.VerificationKeys(context.Background(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if server.count() != 1 {
+		t.Errorf("Fetched %d times, want 1", server.count())
+	}
+}
+
+func TestRemoteKeySetRotation(t *testing.T) {
+	server := newJWKSServer(t, testJWKS(t, newTestEd25519JWK(t, "k1")), 0)
+	set := NewRemoteKeySet(server.URL, nil)
+	set.RefreshInterval = 100 * time.Millisecond
+	ctx := context.Background()
+
+	if _, err := set.VerificationKeys(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	server.set(testJWKS(t, newTestEd25519JWK(t, "k1"),
+		newTestEd25519JWK(t, "k2")), http.StatusOK)
+
+	// Unknown key ID doesn't cause fetch right after the previous one.
+	keys, err := set.VerificationKeys(ctx, "k2")
+	if err != nil || len(keys) != 0 || server.count() != 1 {
+		t.Fatalf("VerificationKeys() = %v, %v after %d fetches", keys, err,
+			server.count())
+	}
+
+	time.Sleep(set.RefreshInterval)
+	keys, err = set.VerificationKeys(ctx, "k2")
+	if err != nil || len(keys) != 1 || server.count() != 2 {
+		t.Fatalf("VerificationKeys() = %v, %v after %d fetches", keys, err,
+			server.count())
+	}
+
+	// Known keys are used while the server is unavailable.
+	server.set([]byte("Service Unavailable"), http.StatusServiceUnavailable)
+	time.Sleep(set.RefreshInterval)
+	keys, err = set.VerificationKeys(ctx, "k3")
+	if err == nil || server.count() != 3 {
+		t.Fatalf("VerificationKeys() = %v, %v after %d fetches", keys, err,
+			server.count())
+	}
+	keys, err = set.VerificationKeys(ctx, "k1")
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("VerificationKeys() = %v, %v", keys, err)
+	}
+}
+
+func TestRemoteKeySetCanceledCaller(t *testing.T) {
+	server := newJWKSServer(t, testJWKS(t, newTestEd25519JWK(t, "k1")),
+		100*time.Millisecond)
+	set := NewRemoteKeySet(server.URL, nil)
+
+	// First caller gives up, the shared fetch still completes for others.
+	ctx, cancel := context.WithTimeout(context.Background(),
+		20*time.Millisecond)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		_, err := set.VerificationKeys(ctx, "k1")
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	keys, err := set.VerificationKeys(context.Background(), "k1")
+	if err != nil || len(keys) != 1 {
+		t.Errorf("VerificationKeys() = %v, %v", keys, err)
+	}
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("Canceled caller error = %v", err)
+	}
+	if server.count() != 1 {
+		t.Errorf("Fetched %d times, want 1", server.count())
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		ttl    time.Duration
+		ok     bool
+	}{
+		{http.Header{}, 0, false},
+		{http.Header{"Cache-Control": {"public, max-age=300"}},
+			300 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=300"}, "Age": {"100"}},
+			200 * time.Second, true},
+		{http.Header{"Cache-Control": {"no-cache"}}, 0, true},
+		{http.Header{"Expires": {"Mon, 01 Jan 2024 01:00:00 GMT"}},
+			time.Hour, true},
+		{http.Header{"Expires": {"0"}}, 0, true},
+	}
+	for _, test := range tests {
+		ttl, ok := cacheTTL(test.header, now)
+		if ttl != test.ttl || ok != test.ok {
+			t.Errorf("cacheTTL(%v) = %v, %v, want %v, %v", test.header,
+				ttl, ok, test.ttl, test.ok)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7515
+Spec: http://tools.ietf.org/html/rfc7518
+Spec: http://tools.ietf.org/html/rfc7519
+*/
+
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWS signing algorithms.
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	RS384 = "RS384"
+	RS512 = "RS512"
+	PS256 = "PS256"
+	PS384 = "PS384"
+	PS512 = "PS512"
+	ES256 = "ES256"
+	ES384 = "ES384"
+	ES512 = "ES512"
+	EdDSA = "EdDSA"
+)
+
+// algorithmHash returns hash function used by JWS algorithm.
+func algorithmHash(alg string) (crypto.Hash, error) {
+	switch alg {
+	case HS256, RS256, PS256, ES256:
+		return crypto.SHA256, nil
+	case HS384, RS384, PS384, ES384:
+		return crypto.SHA384, nil
+	case HS512, RS512, PS512, ES512:
+		return crypto.SHA512, nil
+	case EdDSA:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("Unsupported JWS algorithm: %v", alg)
+}
+
+// defaultAlgorithm returns JWS algorithm matching the key.
+func defaultAlgorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return RS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve.Params().BitSize {
+		case 256:
+			return ES256, nil
+		case 384:
+			return ES384, nil
+		case 521:
+			return ES512, nil
+		}
+	case ed25519.PublicKey:
+		return EdDSA, nil
+	}
+	return "", fmt.Errorf("Unsupported key type: %T", key)
+}
+
+// Lifetime of JWTs signed by the client, when not configured.
+const defaultJWTLifetime = 5 * time.Minute
+
+// JWTSigner holds the private key used to sign JWTs issued by the client.
+type JWTSigner struct {
+	// RSA, ECDSA or Ed25519 private key
+	Key crypto.Signer
+
+	// Key ID sent in the "kid" header, optional
+	KeyID string
+
+	// Signing algorithm, default depends on the key type:
+	// RS256, ES256/ES384/ES512 or EdDSA
+	Algorithm string
+
+	// Lifetime of the JWT, default: 5 minutes
+	Lifetime time.Duration
+}
+
+// lifetime returns Lifetime or the default.
+func (signer *JWTSigner) lifetime() time.Duration {
+	if signer.Lifetime <= 0 {
+		return defaultJWTLifetime
+	}
+	return signer.Lifetime
+}
+
+// sign signs claims with Key, adding "kid" to header.
+func (signer *JWTSigner) sign(header map[string]interface{},
+	claims interface{}) (string, error) {
+	if signer.Key == nil {
+		return "", fmt.Errorf("Private key can't be empty")
+	}
+	alg := signer.Algorithm
+	if alg == "" {
+		var err error
+		if alg, err = defaultAlgorithm(signer.Key.Public()); err != nil {
+			return "", err
+		}
+	}
+	if signer.KeyID != "" {
+		header = cloneJWTHeader(header)
+		header["kid"] = signer.KeyID
+	}
+	return signJWT(alg, signer.Key, header, claims)
+}
+
+// cloneJWTHeader returns a copy of header, which can be modified.
+func cloneJWTHeader(header map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(header)+1)
+	for name, val := range header {
+		copied[name] = val
+	}
+	return copied
+}
+
+// signJWT serializes claims as a compact JWS signed with key.
+// key is []byte for HMAC algorithms, crypto.Signer otherwise.
+// header may provide additional header parameters like "kid".
+func signJWT(alg string, key interface{}, header map[string]interface{},
+	claims interface{}) (string, error) {
+	h := map[string]interface{}{"alg": alg, "typ": "JWT"}
+	for name, val := range header {
+		h[name] = val
+	}
+	rawHeader, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+	rawClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(rawHeader) + "." +
+		base64.RawURLEncoding.EncodeToString(rawClaims)
+
+	sig, err := signJWS(alg, key, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// signJWS computes JWS signature of signingInput.
+func signJWS(alg string, key interface{}, signingInput []byte) (
+	[]byte, error) {
+	hash, err := algorithmHash(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(alg, "HS") {
+		secret, ok := key.([]byte)
+		if !ok || len(secret) == 0 {
+			return nil, fmt.Errorf("%v requires a non-empty secret", alg)
+		}
+		mac := hmac.New(hash.New, secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%v requires a private key, got %T", alg, key)
+	}
+	if alg == EdDSA {
+		if _, ok := signer.Public().(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("EdDSA requires an Ed25519 key")
+		}
+		return signer.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	}
+
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return signer.Sign(rand.Reader, digest, hash)
+		case "PS":
+			return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+				Hash:       hash,
+			})
+		}
+	case *ecdsa.PublicKey:
+		if expected, _ := defaultAlgorithm(pub); expected != alg {
+			break
+		}
+		der, err := signer.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		return ecdsaDERToJWS(der, pub)
+	}
+	return nil, fmt.Errorf("Key of type %T can't be used with %v", key, alg)
+}
+
+// ecdsaDERToJWS converts ASN.1 ECDSA signature to fixed size R || S
+// http://tools.ietf.org/html/rfc7518#section-3.4
+func ecdsaDERToJWS(der []byte, pub *ecdsa.PublicKey) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	sig.R.FillBytes(out[:size])
+	sig.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// Audience represents "aud" claim, which can be a single string or
+// an array of strings.
+type Audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (aud *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = Audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*aud = Audience(multi)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Single audience is encoded
+// as a string.
+func (aud Audience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+// Contains returns true if value is one of the audiences.
+func (aud Audience) Contains(value string) bool {
+	return contains(aud, value)
+}
+
+// newJWTID returns random "jti" claim value.
+func newJWTID() (string, error) {
+	return randomString(16)
+}
+
+// jwsHeader represents JOSE header of a JWS.
+type jwsHeader struct {
+	Algorithm   string `json:"alg"`
+	KeyID       string `json:"kid"`
+	Type        string `json:"typ"`
+	ContentType string `json:"cty"`
+}
+
+// parseJWS splits compact serialized JWS into its decoded parts.
+func parseJWS(raw string) (header jwsHeader, payload, signingInput,
+	signature []byte, err error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return header, nil, nil, nil, fmt.Errorf("Malformed JWT, " +
+			"expected 3 parts")
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, nil, nil, fmt.Errorf("Malformed JWT header: %v",
+			err)
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return header, nil, nil, nil, fmt.Errorf("Malformed JWT header: %v",
+			err)
+	}
+	payload, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, nil, nil, fmt.Errorf("Malformed JWT payload: %v",
+			err)
+	}
+	signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, nil, nil, nil, fmt.Errorf("Malformed JWT signature: %v",
+			err)
+	}
+	signingInput = []byte(parts[0] + "." + parts[1])
+	return header, payload, signingInput, signature, nil
+}
+
+// verifyJWS checks JWS signature of signingInput made with alg.
+func verifyJWS(alg string, key crypto.PublicKey, signingInput,
+	signature []byte) error {
+	hash, err := algorithmHash(alg)
+	if err != nil {
+		return err
+	}
+	if alg == EdDSA {
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("EdDSA requires an Ed25519 key, got %T", key)
+		}
+		if !ed25519.Verify(pub, signingInput, signature) {
+			return fmt.Errorf("Invalid JWS signature")
+		}
+		return nil
+	}
+
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		case "PS":
+			err = rsa.VerifyPSS(pub, hash, digest, signature,
+				&rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			return fmt.Errorf("Key of type %T can't be used with %v", key, alg)
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid JWS signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if expected, _ := defaultAlgorithm(pub); expected != alg {
+			return fmt.Errorf("Key of type %T can't be used with %v", key, alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("Invalid JWS signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("Invalid JWS signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("Key of type %T can't be used with %v", key, alg)
+}
@@ -0,0 +1,187 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7521
+Spec: http://tools.ietf.org/html/rfc7523
+*/
+
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Grant type for JWT bearer authorization grant.
+const GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// JWTAssertion configures JWT used as authorization grant.
+type JWTAssertion struct {
+	// "iss" claim, default: service ClientId
+	Issuer string
+
+	// "sub" claim, default: Issuer
+	Subject string
+
+	// "aud" claim, default: service AccessTokenURL
+	Audience string
+
+	// Key signing the assertion
+	JWTSigner
+
+	// Additional claims, like "scope". They replace claims set from
+	// the fields above.
+	Claims map[string]interface{}
+}
+
+// Sign builds and signs the assertion for service config.
+// http://tools.ietf.org/html/rfc7523#section-3
+func (assertion *JWTAssertion) Sign(config *Config) (string, error) {
+	issuer := assertion.Issuer
+	if issuer == "" {
+		issuer = config.ClientId
+	}
+	subject := assertion.Subject
+	if subject == "" {
+		subject = issuer
+	}
+	audience := assertion.Audience
+	if audience == "" {
+		audience = config.AccessTokenURL.String()
+	}
+	if issuer == "" {
+		return "", fmt.Errorf("Assertion issuer can't be empty")
+	}
+	jti, err := newJWTID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss": issuer,
+		"sub": subject,
+		"aud": audience,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(assertion.lifetime()).Unix(),
+	}
+	for key, value := range assertion.Claims {
+		claims[key] = value
+	}
+	return assertion.sign(nil, claims)
+}
+
+// GetAccessTokenJWTBearer gets token using signed JWT as authorization
+// grant, like Google service accounts.
+//
+//	data, err := ioutil.ReadFile("service-account.json")
+//	assertion, err := oauth2.ParseJSONKey(data)
+//	assertion.Claims = map[string]interface{}{
+//		"scope": "https://www.googleapis.com/auth/devstorage.read_only",
+//	}
+//	service := oauth2.Service("", "", "", assertion.Audience)
+//	token, err := service.GetAccessTokenJWTBearer(assertion)
+func (service *OAuth2Service) GetAccessTokenJWTBearer(
+	assertion *JWTAssertion) (*Token, error) {
+	return service.GetAccessTokenJWTBearerContext(context.Background(),
+		assertion)
+}
+
+// GetAccessTokenJWTBearerContext is like GetAccessTokenJWTBearer but uses
+// ctx for the request.
+func (service *OAuth2Service) GetAccessTokenJWTBearerContext(
+	ctx context.Context, assertion *JWTAssertion) (*Token, error) {
+	signed, err := assertion.Sign(service.Config)
+	if err != nil {
+		return nil, err
+	}
+	return service.assertionToken(ctx, GrantTypeJWTBearer, signed)
+}
+
+// assertionToken gets token using assertion as authorization grant.
+// http://tools.ietf.org/html/rfc7521#section-4.1
+func (service *OAuth2Service) assertionToken(ctx context.Context,
+	grantType, assertion string) (*Token, error) {
+	params := url.Values{}
+
+	params.Set("grant_type", grantType)
+	params.Set("assertion", assertion)
+	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
+
+	return service.getToken(ctx, params)
+}
+
+// ParsePrivateKeyPEM parses RSA, ECDSA or Ed25519 private key in PEM
+// format (PKCS #8, PKCS #1 or SEC 1). Encrypted keys are not supported.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("Unsupported PEM block type: %v", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported key type: %T", key)
+	}
+	if _, err := defaultAlgorithm(signer.Public()); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// ParseJSONKey parses JSON key file, like Google service account key,
+// into assertion with Issuer, Key, KeyID and Audience set.
+func ParseJSONKey(data []byte) (*JWTAssertion, error) {
+	var jsonKey struct {
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyId string `json:"private_key_id"`
+		ClientEmail  string `json:"client_email"`
+		ClientId     string `json:"client_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &jsonKey); err != nil {
+		return nil, err
+	}
+	if jsonKey.PrivateKey == "" {
+		return nil, fmt.Errorf("JSON key has no private_key")
+	}
+	key, err := ParsePrivateKeyPEM([]byte(jsonKey.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := jsonKey.ClientEmail
+	if issuer == "" {
+		issuer = jsonKey.ClientId
+	}
+	return &JWTAssertion{
+		Issuer:    issuer,
+		Audience:  jsonKey.TokenURI,
+		JWTSigner: JWTSigner{Key: key, KeyID: jsonKey.PrivateKeyId},
+	}, nil
+}
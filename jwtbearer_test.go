@@ -0,0 +1,193 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestJWTAssertionSign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Service("client", "", "", "https://example.com/token").Config
+	assertion := &JWTAssertion{
+		JWTSigner: JWTSigner{Key: key, KeyID: "k1"},
+		Claims:    map[string]interface{}{"scope": "read", "sub": "user"},
+	}
+	signed, err := assertion.Sign(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, claims := parseTestJWT(t, signed, key.Public())
+	if header.Algorithm != "ES256" || header.KeyID != "k1" {
+		t.Errorf("Header = %+v", header)
+	}
+	if claims["iss"] != "client" || claims["sub"] != "user" ||
+		claims["aud"] != "https://example.com/token" ||
+		claims["scope"] != "read" || claims["jti"] == nil {
+		t.Errorf("Claims = %v", claims)
+	}
+	lifetime := claims["exp"].(float64) - claims["iat"].(float64)
+	if lifetime != defaultJWTLifetime.Seconds() {
+		t.Errorf("Lifetime = %vs, want %v", lifetime, defaultJWTLifetime)
+	}
+
+	assertion = &JWTAssertion{JWTSigner: JWTSigner{Key: key}}
+	if _, err := assertion.Sign(Service("", "", "", "").Config); err == nil {
+		t.Error("Assertion without issuer signed")
+	}
+	assertion = &JWTAssertion{Issuer: "client"}
+	if _, err := assertion.Sign(config); err == nil {
+		t.Error("Assertion without key signed")
+	}
+}
+
+func TestGetAccessTokenJWTBearer(t *testing.T) {
+	server := newTokenServer(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion := &JWTAssertion{
+		Issuer:    "sa@example.com",
+		Audience:  server.URL + "/token",
+		JWTSigner: JWTSigner{Key: key, Lifetime: time.Minute},
+	}
+	service := Service("", "", "", server.URL+"/token")
+	service.Scope = "read"
+	token, err := service.GetAccessTokenJWTBearer(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q, want at", token.AccessToken)
+	}
+
+	form := server.last(t).PostForm
+	if form.Get("grant_type") != GrantTypeJWTBearer ||
+		form.Get("scope") != "read" || form["client_id"] != nil {
+		t.Errorf("Form = %v", form)
+	}
+	header, claims := parseTestJWT(t, form.Get("assertion"), key.Public())
+	if header.Algorithm != "RS256" {
+		t.Errorf("Algorithm = %v, want RS256", header.Algorithm)
+	}
+	if claims["iss"] != "sa@example.com" || claims["sub"] != "sa@example.com" {
+		t.Errorf("Claims = %v", claims)
+	}
+	if lifetime := claims["exp"].(float64) - claims["iat"].(float64); lifetime != 60 {
+		t.Errorf("Lifetime = %vs, want 60s", lifetime)
+	}
+}
+
+// testKeyPEMs returns key encoded in all supported PEM formats.
+func testKeyPEMs(t *testing.T, key crypto.Signer) [][]byte {
+	t.Helper()
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pems := [][]byte{pem.EncodeToMemory(&pem.Block{
+		Type: "PRIVATE KEY", Bytes: pkcs8})}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		pems = append(pems, pem.EncodeToMemory(&pem.Block{
+			Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pems = append(pems, pem.EncodeToMemory(&pem.Block{
+			Type: "EC PRIVATE KEY", Bytes: der}))
+	}
+	return pems
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []crypto.Signer{rsaKey, ecKey, edKey} {
+		for _, data := range testKeyPEMs(t, key) {
+			parsed, err := ParsePrivateKeyPEM(data)
+			if err != nil {
+				t.Errorf("%T: %v", key, err)
+				continue
+			}
+			type equaler interface {
+				Equal(crypto.PublicKey) bool
+			}
+			if !key.Public().(equaler).Equal(parsed.Public()) {
+				t.Errorf("%T: parsed other key", key)
+			}
+		}
+	}
+
+	invalid := [][]byte{
+		[]byte("not a key"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}),
+	}
+	for _, data := range invalid {
+		if _, err := ParsePrivateKeyPEM(data); err == nil {
+			t.Errorf("Invalid key parsed: %q", data)
+		}
+	}
+}
+
+func TestParseJSONKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"private_key":    string(testKeyPEMs(t, key)[0]),
+		"private_key_id": "k1",
+		"client_email":   "sa@example.com",
+		"client_id":      "123",
+		"token_uri":      "https://example.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, err := ParseJSONKey(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion.Issuer != "sa@example.com" || assertion.KeyID != "k1" ||
+		assertion.Audience != "https://example.com/token" ||
+		!key.PublicKey.Equal(assertion.Key.Public()) {
+		t.Errorf("Assertion = %+v", assertion)
+	}
+
+	if _, err := ParseJSONKey([]byte(`{"client_email":"sa@example.com"}`)); err == nil {
+		t.Error("JSON key without private_key parsed")
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc8252#section-7.3
+*/
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LoopbackFlow completes the authorization code flow for native (CLI or
+// desktop) apps by receiving the redirect on a loopback interface.
+//
+//	flow, err := service.StartLoopback()
+//	if err != nil {
+//		return err
+//	}
+//	defer flow.Close()
+//	fmt.Println("Visit the URL to authorize:", flow.URL)
+//	token, err := flow.Wait(5 * time.Minute)
+type LoopbackFlow struct {
+	// URL to open in the user's browser
+	URL string
+
+	// Redirect URI used for the flow, http://127.0.0.1:port/
+	RedirectURL string
+
+	service   *OAuth2Service
+	authState *AuthState
+	listener  net.Listener
+	server    *http.Server
+
+	once   sync.Once
+	result chan loopbackResult
+}
+
+type loopbackResult struct {
+	token *Token
+	err   error
+}
+
+// StartLoopback starts listening on 127.0.0.1 on an ephemeral port and
+// returns flow with authorization URL using PKCE and state. Service
+// RedirectURL isn't changed, the flow uses a copy of the service.
+func (service *OAuth2Service) StartLoopback() (*LoopbackFlow, error) {
+	// Loopback IP literal is used instead of "localhost", see
+	// http://tools.ietf.org/html/rfc8252#section-8.3
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	authState, params, err := newAuthState(true, false)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	redirectURL := fmt.Sprintf("http://%v/", listener.Addr())
+	flowService := *service
+	config := *service.Config
+	config.RedirectURL = redirectURL
+	flowService.Config = &config
+
+	authURL, err := flowService.BuildAuthorizeURL(authState.State, params)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	flow := &LoopbackFlow{
+		URL:         authURL,
+		RedirectURL: redirectURL,
+		service:     &flowService,
+		authState:   authState,
+		listener:    listener,
+		result:      make(chan loopbackResult, 1),
+	}
+	flow.server = &http.Server{
+		Handler:           http.HandlerFunc(flow.serveHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go flow.server.Serve(listener)
+	return flow, nil
+}
+
+// Wait waits for the redirect until timeout and returns the token.
+// Zero timeout means no timeout.
+func (flow *LoopbackFlow) Wait(timeout time.Duration) (*Token, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return flow.WaitContext(ctx)
+}
+
+// WaitContext is like Wait but waits until ctx is done.
+func (flow *LoopbackFlow) WaitContext(ctx context.Context) (*Token, error) {
+	defer flow.Close()
+	select {
+	case result := <-flow.result:
+		return result.token, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the listener, waiting a moment until the result page is
+// sent. It's safe to call it more than once.
+func (flow *LoopbackFlow) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := flow.server.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		return flow.server.Close()
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// serveHTTP handles the redirect from the authorization server.
+func (flow *LoopbackFlow) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if r.URL.Path != "/" ||
+		(query.Get("code") == "" && query.Get("error") == "") {
+		// Browsers may ask for /favicon.ico and similar.
+		http.NotFound(w, r)
+		return
+	}
+
+	// Requests with wrong state don't end the flow, any local process or
+	// web page can send them.
+	if err := checkState(query, flow.authState.State); err != nil {
+		writeLoopbackPage(w, err)
+		return
+	}
+
+	handled := false
+	flow.once.Do(func() {
+		handled = true
+		code, err := flow.service.ParseCallback(query,
+			flow.authState.State)
+		var token *Token
+		if err == nil {
+			token, err = flow.service.exchangeCode(r, code,
+				flow.authState.CodeVerifier)
+		}
+		writeLoopbackPage(w, err)
+		flow.result <- loopbackResult{token, err}
+	})
+	if !handled {
+		writeLoopbackPage(w, fmt.Errorf("Authorization already completed"))
+	}
+}
+
+const loopbackPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>%[1]v</title></head>
+<body><h1>%[1]v</h1><p>%[2]v</p></body></html>
+`
+
+// writeLoopbackPage tells the user the result of the authorization.
+func writeLoopbackPage(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, loopbackPage, "Authorization failed",
+			html.EscapeString(err.Error()))
+		return
+	}
+	fmt.Fprintf(w, loopbackPage, "Authorization successful",
+		"You can close this window and return to the application.")
+}
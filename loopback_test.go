@@ -0,0 +1,122 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startLoopback starts loopback flow of service using server endpoints.
+func startLoopback(t *testing.T, server *tokenServer) (*LoopbackFlow,
+	string) {
+	service := server.service()
+	service.RedirectURL = "https://app.example.com/callback"
+	flow, err := service.StartLoopback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flow.Close() })
+	if service.RedirectURL != "https://app.example.com/callback" {
+		t.Errorf("Service RedirectURL changed to %v", service.RedirectURL)
+	}
+	return flow, parseURL(t, flow.URL).Query().Get("state")
+}
+
+// redirect sends the browser redirect to the loopback listener.
+func redirect(t *testing.T, flow *LoopbackFlow, path string) int {
+	t.Helper()
+	resp, err := http.Get(strings.TrimSuffix(flow.RedirectURL, "/") + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestLoopbackFlow(t *testing.T) {
+	server := newTokenServer(t)
+	flow, state := startLoopback(t, server)
+	if !strings.HasPrefix(flow.RedirectURL, "http://127.0.0.1:") {
+		t.Errorf("RedirectURL = %v", flow.RedirectURL)
+	}
+	query := parseURL(t, flow.URL).Query()
+	if query.Get("redirect_uri") != flow.RedirectURL || state == "" ||
+		query.Get("code_challenge_method") != PKCEMethodS256 {
+		t.Errorf("Authorization request = %v", query)
+	}
+
+	if status := redirect(t, flow, "/favicon.ico"); status != http.StatusNotFound {
+		t.Errorf("/favicon.ico status = %d", status)
+	}
+	// Requests with wrong state don't end the flow.
+	if status := redirect(t, flow, "/?code=c1&state=other"); status != http.StatusBadRequest {
+		t.Errorf("Wrong state status = %d", status)
+	}
+	if status := redirect(t, flow, "/?error=access_denied"); status != http.StatusBadRequest {
+		t.Errorf("Error without state status = %d", status)
+	}
+	if status := redirect(t, flow, "/?code=c1&state="+state); status != http.StatusOK {
+		t.Errorf("Callback status = %d", status)
+	}
+	if status := redirect(t, flow, "/?code=c2&state="+state); status != http.StatusBadRequest {
+		t.Errorf("Second callback status = %d", status)
+	}
+
+	token, err := flow.Wait(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" {
+		t.Errorf("AccessToken = %q", token.AccessToken)
+	}
+	if server.count() != 1 {
+		t.Fatalf("Sent %d token requests, want 1", server.count())
+	}
+	form := server.last(t).PostForm
+	if form.Get("code") != "c1" || form.Get("code_verifier") == "" ||
+		form.Get("redirect_uri") != flow.RedirectURL {
+		t.Errorf("Token request form = %v", form)
+	}
+}
+
+func TestLoopbackFlowError(t *testing.T) {
+	server := newTokenServer(t)
+	flow, state := startLoopback(t, server)
+	status := redirect(t, flow, "/?error=access_denied&state="+state)
+	if status != http.StatusBadRequest {
+		t.Errorf("Status = %d", status)
+	}
+	_, err := flow.Wait(time.Second)
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) ||
+		tokenError.ErrorCode != ErrorAccessDenied {
+		t.Fatalf("Error = %v, want %v", err, ErrorAccessDenied)
+	}
+	if server.count() != 0 {
+		t.Errorf("Sent %d token requests, want 0", server.count())
+	}
+}
+
+func TestLoopbackFlowTimeout(t *testing.T) {
+	server := newTokenServer(t)
+	flow, _ := startLoopback(t, server)
+	if _, err := flow.Wait(50 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("Error = %v, want context.DeadlineExceeded", err)
+	}
+	// Wait closes the listener.
+	if _, err := http.Get(flow.RedirectURL); err == nil {
+		t.Error("Listener still running")
+	}
+	if err := flow.Close(); err != nil {
+		t.Errorf("Second Close() = %v", err)
+	}
+}
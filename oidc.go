@@ -0,0 +1,285 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://openid.net/specs/openid-connect-core-1_0.html
+*/
+
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// IDTokenClaims represents claims of a verified OpenID Connect ID Token.
+type IDTokenClaims struct {
+	// http://openid.net/specs/openid-connect-core-1_0.html#IDToken
+
+	// Issuer Identifier for the Issuer of the response.
+	Issuer string `json:"iss"`
+
+	// Subject Identifier, unique identifier of the End-User.
+	Subject string `json:"sub"`
+
+	// Audience(s) that this ID Token is intended for.
+	Audience Audience `json:"aud"`
+
+	// Expiration time, seconds since epoch.
+	Expiry int64 `json:"exp"`
+
+	// Time at which the JWT was issued, seconds since epoch.
+	IssuedAt int64 `json:"iat"`
+
+	// Time when the End-User authentication occurred.
+	AuthTime int64 `json:"auth_time,omitempty"`
+
+	// Value used to associate a Client session with an ID Token.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Authentication Context Class Reference.
+	ACR string `json:"acr,omitempty"`
+
+	// Authentication Methods References.
+	AMR []string `json:"amr,omitempty"`
+
+	// Authorized party, the party to which the ID Token was issued.
+	AuthorizedParty string `json:"azp,omitempty"`
+
+	// Access Token hash value.
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	// Code hash value.
+	CodeHash string `json:"c_hash,omitempty"`
+
+	// raw JSON payload
+	raw []byte
+}
+
+// Claims decodes all ID Token claims into v, use it to get claims like
+// "email" or "name".
+func (claims *IDTokenClaims) Claims(v interface{}) error {
+	return json.Unmarshal(claims.raw, v)
+}
+
+// IDTokenVerifier validates OpenID Connect ID Tokens.
+type IDTokenVerifier struct {
+	// Expected "iss" claim, required
+	Issuer string
+
+	// Expected "aud" claim, the client identifier, required
+	ClientId string
+
+	// Keys used to verify ID Token signature
+	KeySet KeySet
+
+	// Accepted signing algorithms, default: RS256
+	SupportedAlgorithms []string
+
+	// Allowed clock difference with the server, default: 1 minute
+	ClockSkew time.Duration
+
+	// Now returns current time, default: time.Now
+	Now func() time.Time
+}
+
+// IDTokenCheck holds values bound to the ID Token which are checked
+// against its claims. Empty values are not checked.
+type IDTokenCheck struct {
+	// Nonce sent in the authorization request, must match "nonce"
+	Nonce string
+
+	// Access token issued with the ID Token, checked against "at_hash"
+	AccessToken string
+
+	// Authorization code issued with the ID Token, checked against
+	// "c_hash"
+	Code string
+}
+
+// IDTokenVerifier returns verifier configured with service Issuer,
+// ClientId and KeySet (or keys from JWKSURL if KeySet is not set).
+//
+//	service, err := oauth2.Discover(issuer, clientId, clientSecret)
+//	token, err := service.GetAccessToken(code)
+//	claims, err := service.IDTokenVerifier().VerifyToken(ctx, token, nonce)
+func (service *OAuth2Service) IDTokenVerifier() *IDTokenVerifier {
+	verifier := &IDTokenVerifier{
+		Issuer:   service.Issuer,
+		ClientId: service.ClientId,
+		KeySet:   service.KeySet,
+	}
+	if verifier.KeySet == nil {
+		verifier.KeySet = NewRemoteKeySet(service.JWKSURL.String(),
+			service.Client)
+	}
+	if service.Metadata != nil {
+		verifier.SupportedAlgorithms =
+			service.Metadata.IDTokenSigningAlgValuesSupported
+	}
+	return verifier
+}
+
+// VerifyToken verifies token.IDToken, checking "at_hash" against
+// token.AccessToken and "nonce" against nonce if not empty.
+func (verifier *IDTokenVerifier) VerifyToken(ctx context.Context,
+	token *Token, nonce string) (*IDTokenClaims, error) {
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("Token has no ID Token")
+	}
+	return verifier.Verify(ctx, token.IDToken, IDTokenCheck{
+		Nonce:       nonce,
+		AccessToken: token.AccessToken,
+	})
+}
+
+// Verify checks signature and claims of rawIDToken.
+func (verifier *IDTokenVerifier) Verify(ctx context.Context,
+	rawIDToken string, check IDTokenCheck) (*IDTokenClaims, error) {
+	// http://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+	// Empty values would match tokens without "iss" or "aud".
+	if verifier.Issuer == "" {
+		return nil, fmt.Errorf("ID Token verifier has no Issuer")
+	}
+	if verifier.ClientId == "" {
+		return nil, fmt.Errorf("ID Token verifier has no ClientId")
+	}
+	header, payload, signingInput, signature, err := parseJWS(rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	algs := verifier.SupportedAlgorithms
+	if len(algs) == 0 {
+		algs = []string{RS256}
+	}
+	if header.Algorithm == "none" || !contains(algs, header.Algorithm) {
+		return nil, fmt.Errorf("Unsupported ID Token algorithm: %v",
+			header.Algorithm)
+	}
+	if verifier.KeySet == nil {
+		return nil, fmt.Errorf("ID Token verifier has no KeySet")
+	}
+	keys, err := verifier.KeySet.VerificationKeys(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No verification key found for kid %q",
+			header.KeyID)
+	}
+	if !verifyWithKeys(keys, header.Algorithm, signingInput, signature) {
+		return nil, fmt.Errorf("Invalid ID Token signature")
+	}
+
+	claims := IDTokenClaims{raw: payload}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Malformed ID Token claims: %v", err)
+	}
+	if err := verifier.checkClaims(&claims, header.Algorithm, check); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifyWithKeys returns true if signature was made by one of the keys.
+func verifyWithKeys(keys []JSONWebKey, alg string, signingInput,
+	signature []byte) bool {
+	for _, key := range keys {
+		if key.Algorithm != "" && key.Algorithm != alg {
+			continue
+		}
+		if verifyJWS(alg, key.Key, signingInput, signature) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// checkClaims validates ID Token claims.
+func (verifier *IDTokenVerifier) checkClaims(claims *IDTokenClaims,
+	alg string, check IDTokenCheck) error {
+	if claims.Issuer != verifier.Issuer {
+		return fmt.Errorf("ID Token issuer mismatch, expected: %v, got: %v",
+			verifier.Issuer, claims.Issuer)
+	}
+	if !claims.Audience.Contains(verifier.ClientId) {
+		return fmt.Errorf("ID Token audience doesn't contain client ID")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty == "" {
+		return fmt.Errorf("ID Token with multiple audiences has no azp")
+	}
+	if claims.AuthorizedParty != "" &&
+		claims.AuthorizedParty != verifier.ClientId {
+		return fmt.Errorf("ID Token azp mismatch, got: %v",
+			claims.AuthorizedParty)
+	}
+
+	now := time.Now
+	if verifier.Now != nil {
+		now = verifier.Now
+	}
+	skew := verifier.ClockSkew
+	if skew == 0 {
+		skew = time.Minute
+	}
+	if claims.Expiry == 0 {
+		return fmt.Errorf("ID Token has no exp")
+	}
+	if now().Add(-skew).After(time.Unix(claims.Expiry, 0)) {
+		return fmt.Errorf("ID Token expired at %v",
+			time.Unix(claims.Expiry, 0))
+	}
+	if claims.IssuedAt == 0 {
+		return fmt.Errorf("ID Token has no iat")
+	}
+	if now().Add(skew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return fmt.Errorf("ID Token issued in the future")
+	}
+
+	if check.Nonce != "" && subtle.ConstantTimeCompare(
+		[]byte(check.Nonce), []byte(claims.Nonce)) != 1 {
+		return fmt.Errorf("ID Token nonce mismatch")
+	}
+	if check.AccessToken != "" && claims.AccessTokenHash != "" {
+		if err := checkTokenHash(alg, check.AccessToken,
+			claims.AccessTokenHash); err != nil {
+			return fmt.Errorf("ID Token at_hash mismatch: %v", err)
+		}
+	}
+	if check.Code != "" && claims.CodeHash != "" {
+		if err := checkTokenHash(alg, check.Code, claims.CodeHash); err != nil {
+			return fmt.Errorf("ID Token c_hash mismatch: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkTokenHash compares at_hash or c_hash with value.
+// http://openid.net/specs/openid-connect-core-1_0.html#CodeIDToken
+func checkTokenHash(alg, value, expected string) error {
+	hash, err := algorithmHash(alg)
+	if err != nil {
+		return err
+	}
+	if alg == EdDSA {
+		// Ed25519 uses SHA-512.
+		hash = crypto.SHA512
+	}
+	h := hash.New()
+	h.Write([]byte(value))
+	sum := h.Sum(nil)
+	got := base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	if subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+		return fmt.Errorf("hash doesn't match")
+	}
+	return nil
+}
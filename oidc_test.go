@@ -0,0 +1,221 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+// staticKeySet implements KeySet with fixed keys.
+type staticKeySet []JSONWebKey
+
+func (keys staticKeySet) VerificationKeys(ctx context.Context, kid string) (
+	[]JSONWebKey, error) {
+	return filterKeys(keys, kid), nil
+}
+
+// idTokenTest signs ID Tokens verified by verifier.
+type idTokenTest struct {
+	key      *ecdsa.PrivateKey
+	now      time.Time
+	verifier *IDTokenVerifier
+}
+
+func newIDTokenTest(t *testing.T) *idTokenTest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &idTokenTest{key: key, now: time.Unix(1700000000, 0)}
+	test.verifier = &IDTokenVerifier{
+		Issuer:              "https://issuer.example.com",
+		ClientId:            "client",
+		KeySet:              staticKeySet{{KeyID: "k1", Key: &key.PublicKey}},
+		SupportedAlgorithms: []string{ES256},
+		Now:                 func() time.Time { return test.now },
+	}
+	return test
+}
+
+// claims returns valid ID Token claims.
+func (test *idTokenTest) claims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   "https://issuer.example.com",
+		"sub":   "user",
+		"aud":   "client",
+		"exp":   test.now.Add(time.Hour).Unix(),
+		"iat":   test.now.Unix(),
+		"nonce": "n-0S6_WzA2Mj",
+		"email": "user@example.com",
+	}
+}
+
+func (test *idTokenTest) sign(t *testing.T,
+	claims map[string]interface{}) string {
+	raw, err := signJWT(ES256, test.key, map[string]interface{}{"kid": "k1"},
+		claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// tokenHash returns at_hash or c_hash of value for ES256.
+func tokenHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func TestIDTokenVerify(t *testing.T) {
+	test := newIDTokenTest(t)
+	claims := test.claims()
+	claims["at_hash"] = tokenHash("at")
+	token := &Token{AccessToken: "at", IDToken: test.sign(t, claims)}
+
+	idToken, err := test.verifier.VerifyToken(context.Background(), token,
+		"n-0S6_WzA2Mj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idToken.Subject != "user" || !idToken.Audience.Contains("client") {
+		t.Errorf("Claims = %+v", idToken)
+	}
+	var extra struct {
+		Email string `json:"email"`
+	}
+	if err := idToken.Claims(&extra); err != nil {
+		t.Fatal(err)
+	}
+	if extra.Email != "user@example.com" {
+		t.Errorf("email = %q", extra.Email)
+	}
+}
+
+func TestIDTokenVerifyClaims(t *testing.T) {
+	test := newIDTokenTest(t)
+	tests := []struct {
+		name   string
+		change func(claims map[string]interface{})
+		check  IDTokenCheck
+	}{
+		{"issuer", func(c map[string]interface{}) {
+			c["iss"] = "https://other.example.com"
+		}, IDTokenCheck{}},
+		{"audience", func(c map[string]interface{}) {
+			c["aud"] = "other"
+		}, IDTokenCheck{}},
+		{"multiple audiences without azp", func(c map[string]interface{}) {
+			c["aud"] = []string{"client", "other"}
+		}, IDTokenCheck{}},
+		{"azp", func(c map[string]interface{}) {
+			c["azp"] = "other"
+		}, IDTokenCheck{}},
+		{"expired", func(c map[string]interface{}) {
+			c["exp"] = test.now.Add(-2 * time.Minute).Unix()
+		}, IDTokenCheck{}},
+		{"no exp", func(c map[string]interface{}) {
+			delete(c, "exp")
+		}, IDTokenCheck{}},
+		{"no iat", func(c map[string]interface{}) {
+			delete(c, "iat")
+		}, IDTokenCheck{}},
+		{"issued in the future", func(c map[string]interface{}) {
+			c["iat"] = test.now.Add(2 * time.Minute).Unix()
+		}, IDTokenCheck{}},
+		{"nonce", nil, IDTokenCheck{Nonce: "other"}},
+		{"at_hash", func(c map[string]interface{}) {
+			c["at_hash"] = tokenHash("at")
+		}, IDTokenCheck{AccessToken: "other"}},
+		{"c_hash", func(c map[string]interface{}) {
+			c["c_hash"] = tokenHash("code")
+		}, IDTokenCheck{Code: "other"}},
+	}
+	for _, tt := range tests {
+		claims := test.claims()
+		if tt.change != nil {
+			tt.change(claims)
+		}
+		_, err := test.verifier.Verify(context.Background(),
+			test.sign(t, claims), tt.check)
+		if err == nil {
+			t.Errorf("%v: invalid ID Token accepted", tt.name)
+		}
+	}
+
+	// Clock skew allows recently expired token.
+	claims := test.claims()
+	claims["exp"] = test.now.Add(-30 * time.Second).Unix()
+	claims["aud"] = []string{"client", "other"}
+	claims["azp"] = "client"
+	_, err := test.verifier.Verify(context.Background(),
+		test.sign(t, claims), IDTokenCheck{})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIDTokenVerifySignature(t *testing.T) {
+	test := newIDTokenTest(t)
+	raw := test.sign(t, test.claims())
+	parts := strings.Split(raw, ".")
+	ctx := context.Background()
+
+	tampered := parts[0] + "." + parts[1] + "." + parts[2][:10] +
+		strings.Repeat("A", len(parts[2])-10)
+	if _, err := test.verifier.Verify(ctx, tampered, IDTokenCheck{}); err == nil {
+		t.Error("Invalid signature accepted")
+	}
+
+	none := base64.RawURLEncoding.EncodeToString(
+		[]byte(`{"alg":"none","kid":"k1"}`)) + "." + parts[1] + "."
+	if _, err := test.verifier.Verify(ctx, none, IDTokenCheck{}); err == nil {
+		t.Error("Unsigned ID Token accepted")
+	}
+
+	test.verifier.SupportedAlgorithms = []string{RS256}
+	if _, err := test.verifier.Verify(ctx, raw, IDTokenCheck{}); err == nil {
+		t.Error("Algorithm not in SupportedAlgorithms accepted")
+	}
+
+	test.verifier.SupportedAlgorithms = []string{ES256}
+	test.verifier.KeySet = staticKeySet{{KeyID: "k2",
+		Key: &test.key.PublicKey}}
+	if _, err := test.verifier.Verify(ctx, raw, IDTokenCheck{}); err == nil {
+		t.Error("ID Token signed with unknown key accepted")
+	}
+}
+
+func TestIDTokenVerifyNotConfigured(t *testing.T) {
+	test := newIDTokenTest(t)
+	claims := test.claims()
+	delete(claims, "iss")
+	raw := test.sign(t, claims)
+
+	// Token without "iss" doesn't match empty Issuer.
+	test.verifier.Issuer = ""
+	if _, err := test.verifier.Verify(context.Background(), raw,
+		IDTokenCheck{}); err == nil {
+		t.Error("Verifier without Issuer accepted ID Token")
+	}
+
+	test.verifier.Issuer = "https://issuer.example.com"
+	test.verifier.ClientId = ""
+	claims = test.claims()
+	claims["aud"] = ""
+	if _, err := test.verifier.Verify(context.Background(),
+		test.sign(t, claims), IDTokenCheck{}); err == nil {
+		t.Error("Verifier without ClientId accepted ID Token")
+	}
+}
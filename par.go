@@ -0,0 +1,107 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc9126
+*/
+
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// PushedAuthorization represents successful Pushed Authorization Response.
+type PushedAuthorization struct {
+	// http://tools.ietf.org/html/rfc9126#section-2.2
+
+	// The request URI referencing the pushed authorization request.
+	RequestURI string `json:"request_uri"`
+
+	// The lifetime in seconds of the request URI.
+	ExpiresIn int64 `json:"expires_in"`
+
+	// The expiration time of the request URI, built from ExpiresIn
+	ExpirationTime time.Time `json:"-"`
+
+	// Authorization URL with only "client_id" and "request_uri"
+	// parameters, send the user to it.
+	URL string `json:"-"`
+}
+
+// PushAuthorizationRequest sends authorization request parameters, the
+// same as GetAuthorizeURLParams uses, directly to the Pushed
+// Authorization Request Endpoint and returns short authorization URL.
+// If service RequestObject is set, parameters are sent in the request
+// object.
+//
+//	pkce, err := oauth2.NewPKCE(oauth2.PKCEMethodS256)
+//	params := url.Values{}
+//	params.Set("code_challenge", pkce.Challenge)
+//	params.Set("code_challenge_method", pkce.Method)
+//	par, err := service.PushAuthorizationRequest(state, params)
+//	// send user to par.URL and get code
+//	token, err := service.GetAccessTokenPKCE(code, pkce.Verifier)
+func (service *OAuth2Service) PushAuthorizationRequest(state string,
+	extra url.Values) (*PushedAuthorization, error) {
+	return service.PushAuthorizationRequestContext(context.Background(),
+		state, extra)
+}
+
+// PushAuthorizationRequestContext is like PushAuthorizationRequest but
+// uses ctx for the request.
+func (service *OAuth2Service) PushAuthorizationRequestContext(
+	ctx context.Context, state string, extra url.Values) (
+	*PushedAuthorization, error) {
+	// http://tools.ietf.org/html/rfc9126#section-2.1
+	if service.PushedAuthorizationURL.String() == "" {
+		return nil, fmt.Errorf("Pushed authorization URL not configured")
+	}
+	params := service.authorizeParams(state, extra)
+	if service.RequestObject != nil {
+		// http://tools.ietf.org/html/rfc9126#section-3
+		requestObject, err := service.RequestObject.build(service.Config,
+			params)
+		if err != nil {
+			return nil, err
+		}
+		params = url.Values{}
+		params.Set("client_id", service.ClientId)
+		params.Set("request", requestObject)
+	}
+
+	resp, raw, err := service.postForm(ctx,
+		service.PushedAuthorizationURL.String(), params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 201 && resp.StatusCode != 200 {
+		return nil, newResponseError(resp, raw)
+	}
+
+	par := PushedAuthorization{}
+	if err := json.Unmarshal(raw, &par); err != nil {
+		return nil, newParseError(resp, raw, err)
+	}
+	if par.RequestURI == "" {
+		return nil, fmt.Errorf("Invalid pushed authorization response")
+	}
+	if par.ExpiresIn > 0 {
+		par.ExpirationTime = time.Now().Add(
+			time.Duration(par.ExpiresIn) * time.Second)
+	}
+
+	// http://tools.ietf.org/html/rfc9126#section-4
+	authParams := url.Values{}
+	authParams.Set("client_id", service.ClientId)
+	authParams.Set("request_uri", par.RequestURI)
+	par.URL = service.authorizeURL(authParams)
+	return &par, nil
+}
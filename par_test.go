@@ -0,0 +1,92 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testRequestURI is a request URI returned by parServer.
+const testRequestURI = "urn:ietf:params:oauth:request_uri:abc"
+
+// parServer returns tokenServer answering pushed authorization requests
+// and service configured to use it.
+func parServer(t *testing.T) (*tokenServer, *OAuth2Service) {
+	server := newTokenServer(t)
+	server.respond(http.StatusCreated,
+		`{"request_uri":"`+testRequestURI+`","expires_in":60}`)
+	service := Service("client", "secret", server.URL+"/authorize?x=1",
+		server.URL+"/token")
+	service.PushedAuthorizationURL = *parseURL(t, server.URL+"/par")
+	service.RedirectURL = "https://app.example.com/callback"
+	return server, service
+}
+
+func TestPushAuthorizationRequest(t *testing.T) {
+	server, service := parServer(t)
+	service.ClientAuth = ClientAuthBasic
+	service.Scope = "openid"
+	extra := url.Values{"code_challenge": {"challenge"}}
+	par, err := service.PushAuthorizationRequest("state", extra)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := server.last(t)
+	if request.URL.Path != "/par" {
+		t.Errorf("Path = %v, want /par", request.URL.Path)
+	}
+	if user, _, _ := request.BasicAuth(); user != "client" {
+		t.Errorf("Basic auth user = %q, want client", user)
+	}
+	form := request.PostForm
+	if form.Get("response_type") != "code" || form.Get("state") != "state" ||
+		form.Get("scope") != "openid" ||
+		form.Get("code_challenge") != "challenge" ||
+		form.Get("redirect_uri") != "https://app.example.com/callback" {
+		t.Errorf("Form = %v", form)
+	}
+
+	if par.RequestURI != testRequestURI || par.ExpiresIn != 60 {
+		t.Errorf("Response = %+v", par)
+	}
+	if lifetime := time.Until(par.ExpirationTime); lifetime > time.Minute ||
+		lifetime < 59*time.Second {
+		t.Errorf("Lifetime = %v, want 1m", lifetime)
+	}
+	want := server.URL + "/authorize?x=1&client_id=client&request_uri=" +
+		url.QueryEscape(testRequestURI)
+	if par.URL != want {
+		t.Errorf("URL = %v, want %v", par.URL, want)
+	}
+}
+
+func TestPushAuthorizationRequestErrors(t *testing.T) {
+	service := Service("client", "secret", "https://example.com/authorize",
+		"https://example.com/token")
+	if _, err := service.PushAuthorizationRequest("state", nil); err == nil {
+		t.Error("Request pushed without endpoint")
+	}
+
+	server, service := parServer(t)
+	server.respond(http.StatusBadRequest,
+		`{"error":"invalid_request","error_description":"Bad scope"}`)
+	_, err := service.PushAuthorizationRequest("state", nil)
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) || tokenError.ErrorCode != "invalid_request" {
+		t.Errorf("Error = %v, want invalid_request", err)
+	}
+
+	server.respond(http.StatusCreated, `{"expires_in":60}`)
+	if _, err := service.PushAuthorizationRequest("state", nil); err == nil {
+		t.Error("Response without request_uri accepted")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7636
+*/
+
+package oauth2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// Code challenge methods defined by RFC 7636.
+const (
+	PKCEMethodS256  = "S256"
+	PKCEMethodPlain = "plain"
+)
+
+// PKCE holds Proof Key for Code Exchange values for a single
+// authorization request.
+//
+// Send Challenge and Method with the authorization request and keep
+// Verifier secret until the code is exchanged for a token.
+type PKCE struct {
+	// High-entropy cryptographic random string (43-128 characters).
+	Verifier string
+
+	// Value derived from Verifier and sent as "code_challenge".
+	Challenge string
+
+	// Method used to derive Challenge, sent as "code_challenge_method".
+	Method string
+}
+
+// NewPKCE generates a new code verifier and derives its challenge using
+// the given method. Empty method defaults to S256.
+func NewPKCE(method string) (*PKCE, error) {
+	verifier, err := GenerateCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+	return PKCEFromVerifier(verifier, method)
+}
+
+// PKCEFromVerifier derives challenge for an existing code verifier.
+// Empty method defaults to S256.
+func PKCEFromVerifier(verifier, method string) (*PKCE, error) {
+	// http://tools.ietf.org/html/rfc7636#section-4.1
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return nil, fmt.Errorf("Code verifier must be 43-128 characters long")
+	}
+	for _, c := range verifier {
+		if !isUnreserved(c) {
+			return nil, fmt.Errorf("Code verifier contains invalid character %q", c)
+		}
+	}
+	if method == "" {
+		method = PKCEMethodS256
+	}
+
+	pkce := &PKCE{Verifier: verifier, Method: method}
+	// http://tools.ietf.org/html/rfc7636#section-4.2
+	switch method {
+	case PKCEMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		pkce.Challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	case PKCEMethodPlain:
+		pkce.Challenge = verifier
+	default:
+		return nil, fmt.Errorf("Unsupported code challenge method: %v", method)
+	}
+	return pkce, nil
+}
+
+// GenerateCodeVerifier returns a new random code verifier built from
+// 32 random octets, as recommended by RFC 7636.
+func GenerateCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// randomString returns n random octets encoded with base64url
+// without padding.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// isUnreserved reports whether c is allowed in a code verifier:
+// ALPHA / DIGIT / "-" / "." / "_" / "~"
+func isUnreserved(c rune) bool {
+	switch {
+	case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		return true
+	case c == '-', c == '.', c == '_', c == '~':
+		return true
+	}
+	return false
+}
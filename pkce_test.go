@@ -0,0 +1,101 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPKCEFromVerifier(t *testing.T) {
+	// http://tools.ietf.org/html/rfc7636#appendix-B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	pkce, err := PKCEFromVerifier(verifier, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkce.Method != PKCEMethodS256 {
+		t.Errorf("Method = %q, want %q", pkce.Method, PKCEMethodS256)
+	}
+	want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if pkce.Challenge != want {
+		t.Errorf("Challenge = %q, want %q", pkce.Challenge, want)
+	}
+
+	pkce, err = PKCEFromVerifier(verifier, PKCEMethodPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkce.Challenge != verifier {
+		t.Errorf("plain Challenge = %q, want %q", pkce.Challenge, verifier)
+	}
+}
+
+func TestPKCEFromVerifierInvalid(t *testing.T) {
+	valid := strings.Repeat("a", 43)
+	tests := []struct {
+		verifier, method string
+	}{
+		{strings.Repeat("a", 42), ""},
+		{strings.Repeat("a", 129), ""},
+		{valid[1:] + "+", ""},
+		{valid, "S512"},
+	}
+	for _, test := range tests {
+		if _, err := PKCEFromVerifier(test.verifier, test.method); err == nil {
+			t.Errorf("PKCEFromVerifier(%q, %q) succeeded",
+				test.verifier, test.method)
+		}
+	}
+}
+
+func TestNewPKCE(t *testing.T) {
+	first, err := NewPKCE(PKCEMethodS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewPKCE(PKCEMethodS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Verifier) != 43 {
+		t.Errorf("Verifier length = %d, want 43", len(first.Verifier))
+	}
+	if first.Verifier == second.Verifier {
+		t.Error("Verifiers aren't random")
+	}
+}
+
+func TestPKCEFlow(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	pkce, err := NewPKCE(PKCEMethodS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parseURL(t, service.GetAuthorizeURLPKCE("xyz", pkce)).Query()
+	if query.Get("code_challenge") != pkce.Challenge ||
+		query.Get("code_challenge_method") != PKCEMethodS256 ||
+		query.Get("state") != "xyz" {
+		t.Errorf("Authorization URL query = %v", query)
+	}
+
+	if _, err := service.GetAccessTokenPKCE("code", pkce.Verifier); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	if form.Get("code_verifier") != pkce.Verifier ||
+		form.Get("grant_type") != "authorization_code" ||
+		form.Get("code") != "code" {
+		t.Errorf("Token request form = %v", form)
+	}
+
+	if _, err := service.GetAccessTokenPKCE("code", ""); err == nil {
+		t.Error("Empty code verifier accepted")
+	}
+}
@@ -7,6 +7,7 @@
 package oauth2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -19,11 +20,17 @@ import (
 var _ = fmt.Printf
 
 // ResRequest represents values needed to make authenticated HTTP requests.
+//
+// Once configured, ResRequest is safe for concurrent use by multiple
+// goroutines. Its fields must not be modified while requests are made.
 type ResRequest struct {
 	// Base URL for API
 	apiBaseURL url.URL
 	// Access token added to each resource request
 	AccessToken string
+	// TokenSource, if set, is used instead of AccessToken to get token
+	// for each resource request, allowing automatic token refresh.
+	TokenSource TokenSource
 	// Header allows you to add custom headers that'll be added to each
 	// resource request
 	Header http.Header
@@ -47,6 +54,11 @@ type ResRequest struct {
 	AccessTokenInHeader bool
 	// Authentication header scheme, default: "Bearer"
 	AccessTokenInHeaderScheme string
+
+	// Client is used to send resource requests, default: http.DefaultClient.
+	// To use custom http.RoundTripper set Client to
+	// &http.Client{Transport: yourTransport}.
+	Client *http.Client
 }
 
 // Request initializes basic values that can be used to make
@@ -63,6 +75,14 @@ func Request(apiBaseURL, accessToken string) *ResRequest {
 	return req
 }
 
+// RequestTokenSource initializes basic values that can be used to make
+// authenticated HTTP requests with tokens obtained from src.
+func RequestTokenSource(apiBaseURL string, src TokenSource) *ResRequest {
+	req := Request(apiBaseURL, "")
+	req.TokenSource = src
+	return req
+}
+
 // setApiBaseURL parse and update req.ApiBaseURL
 func (req *ResRequest) setApiBaseURL(baseURL string) {
 	apiBaseURL, err := url.Parse(strings.TrimRight(baseURL, "/"))
@@ -77,23 +97,42 @@ func (req *ResRequest) ApiBaseURL(baseURL string) {
 	req.setApiBaseURL(baseURL)
 }
 
+// client returns HTTP client used to send resource requests.
+func (req *ResRequest) client() *http.Client {
+	if req.Client == nil {
+		return http.DefaultClient
+	}
+	return req.Client
+}
+
 // buildURL build full URL from req.apiBaseURL and endPoint
 func (req *ResRequest) buildURL(endPoint string) string {
 	endPoint = strings.TrimLeft(endPoint, "/")
 	return req.apiBaseURL.String() + "/" + endPoint
 }
 
+// accessToken returns access token for the next resource request.
+func (req *ResRequest) accessToken(ctx context.Context) (string, error) {
+	if req.TokenSource == nil {
+		return req.AccessToken, nil
+	}
+	token, err := tokenFromSource(ctx, req.TokenSource)
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
 // updateTokenInURL add access token to fullURL
 // if req.AccessTokenInURL is set to true.
-func (req *ResRequest) updateTokenInURL(fullURL string) (string, error) {
+func (req *ResRequest) updateTokenInURL(fullURL, accessToken string) (
+	string, error) {
 	if req.AccessTokenInURL {
 		parsedURL, err := url.Parse(fullURL)
 		if err != nil {
 			return "", errors.New("Error updating token in URL")
 		}
-		params, _ := url.ParseQuery(parsedURL.RawQuery)
-		params.Set(req.AccessTokenInURLParam, req.AccessToken)
-		parsedURL.RawQuery = params.Encode()
+		setTokenInURL(parsedURL, req.AccessTokenInURLParam, accessToken)
 		fullURL = parsedURL.String()
 	}
 	return fullURL, nil
@@ -101,15 +140,48 @@ func (req *ResRequest) updateTokenInURL(fullURL string) (string, error) {
 
 // updateTokenInHeader add access token to request header
 // if req.AccessTokenInHeader is set to true.
-func (req *ResRequest) updateTokenInHeader(request *http.Request) (
-	updatedRequest *http.Request) {
+func (req *ResRequest) updateTokenInHeader(request *http.Request,
+	accessToken string) (updatedRequest *http.Request) {
 	if req.AccessTokenInHeader {
-		authHeader := req.AccessTokenInHeaderScheme + " " + req.AccessToken
-		request.Header.Set("Authorization", authHeader)
+		setTokenInHeader(request.Header, req.AccessTokenInHeaderScheme,
+			accessToken)
 	}
 	return request
 }
 
+// setTokenInURL adds access token to u query as param.
+func setTokenInURL(u *url.URL, param, accessToken string) {
+	params, _ := url.ParseQuery(u.RawQuery)
+	params.Set(param, accessToken)
+	u.RawQuery = params.Encode()
+}
+
+// setTokenInHeader adds access token to "Authorization" header.
+func setTokenInHeader(header http.Header, scheme, accessToken string) {
+	header.Set("Authorization", scheme+" "+accessToken)
+}
+
+// Transport returns http.RoundTripper that adds access token to requests
+// the same way req does. Use it to make requests with http.Client.
+func (req *ResRequest) Transport() *Transport {
+	src := req.TokenSource
+	if src == nil {
+		src = StaticTokenSource(&Token{AccessToken: req.AccessToken})
+	}
+	var base http.RoundTripper
+	if req.Client != nil {
+		base = req.Client.Transport
+	}
+	return &Transport{
+		Source:                    src,
+		Base:                      base,
+		AccessTokenInURL:          req.AccessTokenInURL,
+		AccessTokenInURLParam:     req.AccessTokenInURLParam,
+		AccessTokenInHeader:       req.AccessTokenInHeader,
+		AccessTokenInHeaderScheme: req.AccessTokenInHeaderScheme,
+	}
+}
+
 // Do updates HTTP request with access token. Next sends an HTTP request
 // and returns an HTTP response
 //func (req *Request) Do(req *http.Request) (
@@ -120,62 +192,115 @@ func (req *ResRequest) updateTokenInHeader(request *http.Request) (
 // Delete issues a DELETE to the specified API endpoint.
 func (req *ResRequest) Delete(endPoint string) (
 	resp *http.Response, err error) {
-	return req.sendRequest("DELETE", endPoint, nil)
+	return req.sendRequest(context.Background(), "DELETE", endPoint, nil)
+}
+
+// DeleteContext is like Delete but uses ctx for the request.
+func (req *ResRequest) DeleteContext(ctx context.Context, endPoint string) (
+	resp *http.Response, err error) {
+	return req.sendRequest(ctx, "DELETE", endPoint, nil)
 }
 
 // Get issues a GET to the specified API endpoint.
 func (req *ResRequest) Get(endPoint string) (
 	resp *http.Response, err error) {
-	return req.sendRequest("GET", endPoint, nil)
+	return req.sendRequest(context.Background(), "GET", endPoint, nil)
+}
+
+// GetContext is like Get but uses ctx for the request.
+func (req *ResRequest) GetContext(ctx context.Context, endPoint string) (
+	resp *http.Response, err error) {
+	return req.sendRequest(ctx, "GET", endPoint, nil)
 }
 
 // Head issues a HEAD to the specified API endpoint.
 func (req *ResRequest) Head(endPoint string) (
 	resp *http.Response, err error) {
-	return req.sendRequest("HEAD", endPoint, nil)
+	return req.sendRequest(context.Background(), "HEAD", endPoint, nil)
+}
+
+// HeadContext is like Head but uses ctx for the request.
+func (req *ResRequest) HeadContext(ctx context.Context, endPoint string) (
+	resp *http.Response, err error) {
+	return req.sendRequest(ctx, "HEAD", endPoint, nil)
 }
 
 // Options issues a OPTIONS to the specified API endpoint.
 func (req *ResRequest) Options(endPoint string) (
 	resp *http.Response, err error) {
-	return req.sendRequest("OPTIONS", endPoint, nil)
+	return req.sendRequest(context.Background(), "OPTIONS", endPoint, nil)
+}
+
+// OptionsContext is like Options but uses ctx for the request.
+func (req *ResRequest) OptionsContext(ctx context.Context, endPoint string) (
+	resp *http.Response, err error) {
+	return req.sendRequest(ctx, "OPTIONS", endPoint, nil)
 }
 
 // Patch issues a PATCH to the specified API endpoint, with data's keys
 // and values urlencoded as the request body.
 func (req *ResRequest) Patch(endPoint string, data url.Values) (
 	resp *http.Response, err error) {
-	return req.sendRequest("PATCH", endPoint, data)
+	return req.sendRequest(context.Background(), "PATCH", endPoint, data)
+}
+
+// PatchContext is like Patch but uses ctx for the request.
+func (req *ResRequest) PatchContext(ctx context.Context, endPoint string,
+	data url.Values) (resp *http.Response, err error) {
+	return req.sendRequest(ctx, "PATCH", endPoint, data)
 }
 
 // Post issues a POST to the specified API endpoint, with data's keys
 // and values urlencoded as the request body.
 func (req *ResRequest) Post(endPoint string, data url.Values) (
 	resp *http.Response, err error) {
-	return req.sendRequest("POST", endPoint, data)
+	return req.sendRequest(context.Background(), "POST", endPoint, data)
+}
+
+// PostContext is like Post but uses ctx for the request.
+func (req *ResRequest) PostContext(ctx context.Context, endPoint string,
+	data url.Values) (resp *http.Response, err error) {
+	return req.sendRequest(ctx, "POST", endPoint, data)
 }
 
 // Put issues a PUT to the specified API endpoint, with data's keys and values
 // urlencoded as the request body.
 func (req *ResRequest) Put(endPoint string, data url.Values) (
 	resp *http.Response, err error) {
-	return req.sendRequest("PUT", endPoint, data)
+	return req.sendRequest(context.Background(), "PUT", endPoint, data)
+}
+
+// PutContext is like Put but uses ctx for the request.
+func (req *ResRequest) PutContext(ctx context.Context, endPoint string,
+	data url.Values) (resp *http.Response, err error) {
+	return req.sendRequest(ctx, "PUT", endPoint, data)
 }
 
 // Trace issues a TRACE to the specified API endpoint.
 func (req *ResRequest) Trace(endPoint string) (
 	resp *http.Response, err error) {
-	return req.sendRequest("TRACE", endPoint, nil)
+	return req.sendRequest(context.Background(), "TRACE", endPoint, nil)
+}
+
+// TraceContext is like Trace but uses ctx for the request.
+func (req *ResRequest) TraceContext(ctx context.Context, endPoint string) (
+	resp *http.Response, err error) {
+	return req.sendRequest(ctx, "TRACE", endPoint, nil)
 }
 
 // sendRequest issues OAuth-authenticated request method to the specified
 // API endpoint, with data's keys and values URL-encoded as the request body.
 // Caller should close resp.Body when done reading from it.
-func (req *ResRequest) sendRequest(method, endPoint string, data url.Values) (
-	resp *http.Response, err error) {
+func (req *ResRequest) sendRequest(ctx context.Context, method,
+	endPoint string, data url.Values) (resp *http.Response, err error) {
+	accessToken, err := req.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	fullURL := req.buildURL(endPoint)
 
-	fullURL, err = req.updateTokenInURL(fullURL)
+	fullURL, err = req.updateTokenInURL(fullURL, accessToken)
 	if err != nil {
 		return nil, err
 	}
@@ -190,13 +315,14 @@ func (req *ResRequest) sendRequest(method, endPoint string, data url.Values) (
 
 	//fmt.Println(fullURL)
 
-	request, err := http.NewRequest(method, fullURL, body)
+	request, err := http.NewRequestWithContext(ctx, method, fullURL, body)
 	if err != nil {
 		return nil, errors.New("Error building request")
 	}
 
-	request.Header = req.Header
-	request = req.updateTokenInHeader(request)
+	// Copy headers, req.Header is shared by all requests.
+	request.Header = cloneHeader(req.Header)
+	request = req.updateTokenInHeader(request, accessToken)
 
 	if data != nil {
 		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -207,5 +333,5 @@ func (req *ResRequest) sendRequest(method, endPoint string, data url.Values) (
 	//	fmt.Println(key, val)
 	//}
 
-	return http.DefaultClient.Do(request)
+	return req.client().Do(request)
 }
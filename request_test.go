@@ -0,0 +1,59 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRequestClient(t *testing.T) {
+	var sent *http.Request
+	req := Request("https://api.example.com/v1/", "at")
+	req.AccessTokenInHeader = true
+	req.Client = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (
+			*http.Response, error) {
+			sent = r
+			return &http.Response{StatusCode: 200, Body: http.NoBody,
+				Request: r}, nil
+		}),
+	}
+
+	resp, err := req.Get("/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if sent.URL.String() != "https://api.example.com/v1/users" {
+		t.Errorf("URL = %v", sent.URL)
+	}
+	if sent.Header.Get("Authorization") != "Bearer at" {
+		t.Errorf("Authorization = %q", sent.Header.Get("Authorization"))
+	}
+	if req.Header.Get("Authorization") != "" {
+		t.Error("Request Header modified")
+	}
+}
+
+func TestRequestContextCanceled(t *testing.T) {
+	req := Request("https://api.example.com", "at")
+	req.Client = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (
+			*http.Response, error) {
+			return nil, r.Context().Err()
+		}),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := req.GetContext(ctx, "/users"); !errors.Is(err,
+		context.Canceled) {
+		t.Fatalf("Error = %v, want context.Canceled", err)
+	}
+}
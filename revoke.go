@@ -0,0 +1,78 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7009
+*/
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Token type hints.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// RevokeToken revokes access or refresh token. tokenTypeHint is
+// optional, use TokenTypeHintAccessToken or TokenTypeHintRefreshToken.
+//
+// If the server doesn't support revocation of given token type returned
+// *TokenError has ErrorCode set to ErrorUnsupportedTokenType.
+func (service *OAuth2Service) RevokeToken(token, tokenTypeHint string) error {
+	return service.RevokeTokenContext(context.Background(), token,
+		tokenTypeHint)
+}
+
+// RevokeTokenContext is like RevokeToken but uses ctx for the request.
+func (service *OAuth2Service) RevokeTokenContext(ctx context.Context,
+	token, tokenTypeHint string) error {
+	// http://tools.ietf.org/html/rfc7009#section-2.1
+	if service.RevocationURL.String() == "" {
+		return fmt.Errorf("Revocation URL not configured")
+	}
+	if len(token) == 0 {
+		return fmt.Errorf("Token can't be empty")
+	}
+	params := url.Values{}
+	params.Set("token", token)
+	(*MyUrlValues)(&params).CheckAndSet("token_type_hint", tokenTypeHint)
+
+	resp, raw, err := service.postForm(ctx, service.RevocationURL.String(),
+		params)
+	if err != nil {
+		return err
+	}
+	// http://tools.ietf.org/html/rfc7009#section-2.2
+	// Invalid tokens don't cause an error response, 200 is returned.
+	if resp.StatusCode/100 != 2 {
+		return newResponseError(resp, raw)
+	}
+	return nil
+}
+
+// Revoke revokes refresh token (which by server policy usually also
+// invalidates access tokens issued with it) or access token when
+// refresh token is not set.
+func (service *OAuth2Service) Revoke(token *Token) error {
+	return service.RevokeContext(context.Background(), token)
+}
+
+// RevokeContext is like Revoke but uses ctx for the request.
+func (service *OAuth2Service) RevokeContext(ctx context.Context,
+	token *Token) error {
+	if token.RefreshToken != "" {
+		return service.RevokeTokenContext(ctx, token.RefreshToken,
+			TokenTypeHintRefreshToken)
+	}
+	return service.RevokeTokenContext(ctx, token.AccessToken,
+		TokenTypeHintAccessToken)
+}
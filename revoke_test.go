@@ -0,0 +1,58 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestRevoke(t *testing.T) {
+	server := newTokenServer(t)
+	server.respond(http.StatusOK, "")
+	service := server.service()
+
+	if err := service.RevokeToken("at", ""); err == nil {
+		t.Error("Missing RevocationURL accepted")
+	}
+
+	service.RevocationURL = *parseURL(t, server.URL+"/revoke")
+	err := service.Revoke(&Token{AccessToken: "at", RefreshToken: "rt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := server.last(t)
+	if r.URL.Path != "/revoke" || r.PostForm.Get("token") != "rt" ||
+		r.PostForm.Get("token_type_hint") != TokenTypeHintRefreshToken ||
+		r.PostForm.Get("client_id") != "client" {
+		t.Errorf("Request = %v %v", r.URL.Path, r.PostForm)
+	}
+
+	if err := service.Revoke(&Token{AccessToken: "at"}); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	if form.Get("token") != "at" ||
+		form.Get("token_type_hint") != TokenTypeHintAccessToken {
+		t.Errorf("Form = %v", form)
+	}
+}
+
+func TestRevokeUnsupportedTokenType(t *testing.T) {
+	server := newTokenServer(t)
+	server.respond(http.StatusBadRequest, `{"error":"unsupported_token_type"}`)
+	service := server.service()
+	service.RevocationURL = *parseURL(t, server.URL+"/revoke")
+
+	err := service.RevokeToken("at", TokenTypeHintAccessToken)
+	var tokenError *TokenError
+	if !errors.As(err, &tokenError) ||
+		tokenError.ErrorCode != ErrorUnsupportedTokenType {
+		t.Fatalf("Error = %v, want %v", err, ErrorUnsupportedTokenType)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc7522
+*/
+
+package oauth2
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Grant type for SAML 2.0 bearer assertion grant.
+const GrantTypeSAML2Bearer = "urn:ietf:params:oauth:grant-type:saml2-bearer"
+
+// AssertionProvider provides assertions used as authorization grant,
+// for example SAML assertions issued by identity provider.
+type AssertionProvider interface {
+	// Assertion returns new assertion, base64url encoded.
+	Assertion(ctx context.Context) (string, error)
+}
+
+// AssertionProviderFunc is an adapter to allow the use of ordinary
+// functions as AssertionProvider.
+type AssertionProviderFunc func(ctx context.Context) (string, error)
+
+// Assertion calls f(ctx).
+func (f AssertionProviderFunc) Assertion(ctx context.Context) (
+	string, error) {
+	return f(ctx)
+}
+
+// EncodeSAML2Assertion encodes SAML assertion XML using base64url without
+// padding, as required for the "assertion" parameter.
+func EncodeSAML2Assertion(assertionXML []byte) string {
+	return base64.RawURLEncoding.EncodeToString(assertionXML)
+}
+
+// GetAccessTokenSAML2 gets token using base64url encoded SAML 2.0
+// assertion as authorization grant.
+func (service *OAuth2Service) GetAccessTokenSAML2(assertion string) (
+	*Token, error) {
+	return service.GetAccessTokenSAML2Context(context.Background(),
+		assertion)
+}
+
+// GetAccessTokenSAML2Context is like GetAccessTokenSAML2 but uses ctx for
+// the request.
+func (service *OAuth2Service) GetAccessTokenSAML2Context(ctx context.Context,
+	assertion string) (*Token, error) {
+	// http://tools.ietf.org/html/rfc7522#section-2.1
+	// The value must be base64url encoded, padding is allowed but
+	// should not be used.
+	if assertion == "" {
+		return nil, fmt.Errorf("Assertion can't be empty")
+	}
+	_, err := base64.RawURLEncoding.DecodeString(
+		strings.TrimRight(assertion, "="))
+	if err != nil {
+		return nil, fmt.Errorf("Assertion must be base64url encoded: %v", err)
+	}
+	return service.assertionToken(ctx, GrantTypeSAML2Bearer, assertion)
+}
+
+// SAML2TokenSource returns a TokenSource that gets new token, using new
+// assertion from provider, when the current one expires.
+func (service *OAuth2Service) SAML2TokenSource(
+	provider AssertionProvider) TokenSource {
+	return &saml2TokenSource{service: service, provider: provider}
+}
+
+type saml2TokenSource struct {
+	service  *OAuth2Service
+	provider AssertionProvider
+
+	mu    sync.Mutex
+	token *Token
+}
+
+func (s *saml2TokenSource) Token() (*Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+func (s *saml2TokenSource) TokenContext(ctx context.Context) (
+	*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != nil && !s.token.expiredWithin(DefaultExpiryDelta) {
+		return s.token, nil
+	}
+	assertion, err := s.provider.Assertion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.service.GetAccessTokenSAML2Context(ctx, assertion)
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
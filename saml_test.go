@@ -0,0 +1,85 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestGetAccessTokenSAML2(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	assertion := EncodeSAML2Assertion(
+		[]byte("<saml:Assertion>??>></saml:Assertion>"))
+	if _, err := service.GetAccessTokenSAML2(assertion); err != nil {
+		t.Fatal(err)
+	}
+	form := server.last(t).PostForm
+	if form.Get("grant_type") != GrantTypeSAML2Bearer ||
+		form.Get("assertion") != assertion {
+		t.Errorf("Form = %v", form)
+	}
+
+	// Padding is allowed, standard base64 isn't.
+	if _, err := service.GetAccessTokenSAML2("YWJj=="); err != nil {
+		t.Errorf("Padded assertion: %v", err)
+	}
+	for _, invalid := range []string{"", "a+b/"} {
+		if _, err := service.GetAccessTokenSAML2(invalid); err == nil {
+			t.Errorf("Assertion %q accepted", invalid)
+		}
+	}
+	if server.count() != 2 {
+		t.Errorf("Sent %d requests, want 2", server.count())
+	}
+}
+
+func TestSAML2TokenSource(t *testing.T) {
+	server := newTokenServer(t)
+	calls := 0
+	src := server.service().SAML2TokenSource(AssertionProviderFunc(
+		func(ctx context.Context) (string, error) {
+			calls++
+			return "YWJj", nil
+		}))
+	for i := 0; i < 2; i++ {
+		if _, err := src.Token(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 || server.count() != 1 {
+		t.Errorf("Got %d assertions and %d tokens, want 1", calls,
+			server.count())
+	}
+
+	// Token expiring within DefaultExpiryDelta is replaced using new
+	// assertion.
+	server.respond(http.StatusOK, `{"access_token":"short","expires_in":1}`)
+	src = server.service().SAML2TokenSource(AssertionProviderFunc(
+		func(ctx context.Context) (string, error) {
+			calls++
+			return "YWJj", nil
+		}))
+	src.Token()
+	if token, err := src.Token(); err != nil || token.AccessToken != "short" {
+		t.Fatalf("Token() = %v, %v", token, err)
+	}
+	if calls != 3 {
+		t.Errorf("Got %d assertions, want 3", calls)
+	}
+
+	failing := server.service().SAML2TokenSource(AssertionProviderFunc(
+		func(ctx context.Context) (string, error) {
+			return "", errors.New("IdP unavailable")
+		}))
+	if _, err := failing.Token(); err == nil {
+		t.Error("Provider error not returned")
+	}
+}
@@ -7,9 +7,11 @@
 package oauth2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"mime"
 	"net/http"
 	"net/url"
@@ -18,10 +20,34 @@ import (
 	"time"
 )
 
+// OAuth2Service represents OAuth 2.0 client of the authorization server.
+//
+// Once configured, OAuth2Service is safe for concurrent use by multiple
+// goroutines. Its fields must not be modified while requests are made.
 type OAuth2Service struct {
 	// AuthHeader allows you to add custom headers that'll be added to each
 	// access token request.
 	AuthHeader http.Header
+	// ClientAuth is used to authenticate the client in each access token
+	// request. Default: ClientAuthBody
+	ClientAuth ClientAuth
+	// Client is used to send requests to the authorization server,
+	// default: http.DefaultClient. To use custom http.RoundTripper set
+	// Client to &http.Client{Transport: yourTransport}.
+	Client *http.Client
+	// IntrospectionCache, if set, stores active token introspection
+	// responses until token expiration.
+	IntrospectionCache *IntrospectionCache
+	// KeySet provides the authorization server's JWT signing keys, set
+	// by Discover from "jwks_uri".
+	KeySet KeySet
+	// DefaultTokenLifetime is used to set Token.ExpirationTime when
+	// the server doesn't send "expires_in". Zero means token expiration
+	// is unknown.
+	DefaultTokenLifetime time.Duration
+	// RequestObject, if set, makes authorization URLs carry parameters
+	// in a signed request object (JWT-Secured Authorization Request).
+	RequestObject *RequestObject
 	*Config
 }
 
@@ -29,14 +55,7 @@ type OAuth2Service struct {
 func Service(clientId, clientSecret string,
 	authorizeURL, accessTokenURL string) *OAuth2Service {
 
-	service := new(OAuth2Service)
-	service.AuthHeader = make(http.Header)
-	service.AuthHeader.Set("Accept", "application/json")
-	service.AuthHeader.Set("Content-Type", "application/x-www-form-urlencoded")
-	service.Config = new(Config)
-
-	service.ClientId = clientId
-	service.ClientSecret = clientSecret
+	service := newService(clientId, clientSecret)
 
 	authURL, err := url.Parse(authorizeURL)
 	if err != nil {
@@ -49,16 +68,72 @@ func Service(clientId, clientSecret string,
 		panic("accessTokenURL error: " + err.Error())
 	}
 	service.AccessTokenURL = *tokenURL
+
+	return service
+}
+
+// newService initializes service without endpoints.
+func newService(clientId, clientSecret string) *OAuth2Service {
+	service := new(OAuth2Service)
+	service.AuthHeader = make(http.Header)
+	service.AuthHeader.Set("Accept", "application/json")
+	service.AuthHeader.Set("Content-Type", "application/x-www-form-urlencoded")
+	service.Config = new(Config)
+
+	service.ClientId = clientId
+	service.ClientSecret = clientSecret
 	service.ResponseType = "code"
 
 	return service
 }
 
-// GetAuthorizeURL
+// GetAuthorizeURL returns authorization URL. If RequestObject is set,
+// BuildAuthorizeURL should be used instead, see GetAuthorizeURLParams.
 func (service *OAuth2Service) GetAuthorizeURL(state string) string {
+	return service.GetAuthorizeURLParams(state, nil)
+}
+
+// GetAuthorizeURLPKCE returns authorization URL with PKCE code challenge
+// http://tools.ietf.org/html/rfc7636#section-4.3
+// Keep pkce.Verifier and pass it to GetAccessTokenPKCE.
+//
+//	pkce, err := oauth2.NewPKCE(oauth2.PKCEMethodS256)
+//	authURL := service.GetAuthorizeURLPKCE(state, pkce)
+//	// send user to authURL and get code
+//	token, err := service.GetAccessTokenPKCE(code, pkce.Verifier)
+func (service *OAuth2Service) GetAuthorizeURLPKCE(state string, pkce *PKCE) string {
+	params := url.Values{}
+	params.Set("code_challenge", pkce.Challenge)
+	params.Set("code_challenge_method", pkce.Method)
+	return service.GetAuthorizeURLParams(state, params)
+}
+
+// GetAuthorizeURLParams returns authorization URL with custom URL
+// parameters added to the default ones.
+//
+// If RequestObject is set, parameters are sent in the request object and
+// empty string is returned when it can't be built. Use BuildAuthorizeURL
+// to get the error.
+func (service *OAuth2Service) GetAuthorizeURLParams(state string,
+	extra url.Values) string {
+	authURL, err := service.BuildAuthorizeURL(state, extra)
+	if err != nil {
+		// Parameters are never sent unprotected when request object
+		// is required.
+		return ""
+	}
+	return authURL
+}
+
+// authorizeParams returns authorization request parameters.
+func (service *OAuth2Service) authorizeParams(state string,
+	extra url.Values) url.Values {
 	// http://tools.ietf.org/html/rfc6749#section-4.1
 	// http://tools.ietf.org/html/rfc6749#section-4.2
 	params := url.Values{}
+	for key, val := range extra {
+		params[key] = val
+	}
 
 	params.Set("response_type", service.ResponseType)
 	params.Set("client_id", service.ClientId)
@@ -66,19 +141,31 @@ func (service *OAuth2Service) GetAuthorizeURL(state string) string {
 	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
 	(*MyUrlValues)(&params).CheckAndSet("state", state)
 	(*MyUrlValues)(&params).CheckAndSet("access_type", service.AccessType)
+	return params
+}
 
+// authorizeURL returns AuthorizeURL with params added to its query.
+func (service *OAuth2Service) authorizeURL(params url.Values) string {
+	// Build URL from a copy, so service.AuthorizeURL stays unchanged.
+	authURL := service.AuthorizeURL
 	query := params.Encode()
-	if service.AuthorizeURL.RawQuery == "" {
-		service.AuthorizeURL.RawQuery = query
+	if authURL.RawQuery == "" {
+		authURL.RawQuery = query
 	} else {
-		service.AuthorizeURL.RawQuery += "&" + query
+		authURL.RawQuery += "&" + query
 	}
-	return service.AuthorizeURL.String()
+	return authURL.String()
 }
 
 // GetAccessToken
 func (service *OAuth2Service) GetAccessToken(accessCode string) (
 	*Token, error) {
+	return service.GetAccessTokenContext(context.Background(), accessCode)
+}
+
+// GetAccessTokenContext is like GetAccessToken but uses ctx for the request.
+func (service *OAuth2Service) GetAccessTokenContext(ctx context.Context,
+	accessCode string) (*Token, error) {
 	// http://tools.ietf.org/html/rfc6749#section-4.1.3
 	if len(accessCode) == 0 {
 		return nil, fmt.Errorf("Access code can't be empty")
@@ -89,12 +176,49 @@ func (service *OAuth2Service) GetAccessToken(accessCode string) (
 	params.Set("code", accessCode)
 	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
 
-	return service.getToken(params)
+	return service.getToken(ctx, params)
+}
+
+// GetAccessTokenPKCE exchanges access code for token sending PKCE
+// code verifier used to build the authorization URL challenge.
+func (service *OAuth2Service) GetAccessTokenPKCE(accessCode,
+	codeVerifier string) (*Token, error) {
+	return service.GetAccessTokenPKCEContext(context.Background(),
+		accessCode, codeVerifier)
+}
+
+// GetAccessTokenPKCEContext is like GetAccessTokenPKCE but uses ctx
+// for the request.
+func (service *OAuth2Service) GetAccessTokenPKCEContext(ctx context.Context,
+	accessCode, codeVerifier string) (*Token, error) {
+	// http://tools.ietf.org/html/rfc7636#section-4.5
+	if len(accessCode) == 0 {
+		return nil, fmt.Errorf("Access code can't be empty")
+	}
+	if len(codeVerifier) == 0 {
+		return nil, fmt.Errorf("Code verifier can't be empty")
+	}
+	params := url.Values{}
+
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", accessCode)
+	params.Set("code_verifier", codeVerifier)
+	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
+
+	return service.getToken(ctx, params)
 }
 
 // GetAccessTokenPassword
 func (service *OAuth2Service) GetAccessTokenPassword(
 	username, password string) (*Token, error) {
+	return service.GetAccessTokenPasswordContext(context.Background(),
+		username, password)
+}
+
+// GetAccessTokenPasswordContext is like GetAccessTokenPassword but uses ctx
+// for the request.
+func (service *OAuth2Service) GetAccessTokenPasswordContext(
+	ctx context.Context, username, password string) (*Token, error) {
 	// http://tools.ietf.org/html/rfc6749#section-4.3
 	params := url.Values{}
 
@@ -103,23 +227,45 @@ func (service *OAuth2Service) GetAccessTokenPassword(
 	params.Set("password", password)
 	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
 
-	return service.getToken(params)
+	return service.getToken(ctx, params)
 }
 
 // GetAccessTokenCredentials
 func (service *OAuth2Service) GetAccessTokenCredentials() (*Token, error) {
+	return service.GetAccessTokenCredentialsContext(context.Background())
+}
+
+// GetAccessTokenCredentialsContext is like GetAccessTokenCredentials but
+// uses ctx for the request.
+func (service *OAuth2Service) GetAccessTokenCredentialsContext(
+	ctx context.Context) (*Token, error) {
+	return service.credentialsToken(ctx, service.Scope, "")
+}
+
+// credentialsToken gets client credentials token for scope and audience.
+func (service *OAuth2Service) credentialsToken(ctx context.Context,
+	scope, audience string) (*Token, error) {
 	// http://tools.ietf.org/html/rfc6749#section-4.4
 	params := url.Values{}
 
 	params.Set("grant_type", "client_credentials")
-	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
+	(*MyUrlValues)(&params).CheckAndSet("scope", scope)
+	(*MyUrlValues)(&params).CheckAndSet("audience", audience)
 
-	return service.getToken(params)
+	return service.getToken(ctx, params)
 }
 
 // RefreshAccessToken
 func (service *OAuth2Service) RefreshAccessToken(refreshToken string) (
 	*Token, error) {
+	return service.RefreshAccessTokenContext(context.Background(),
+		refreshToken)
+}
+
+// RefreshAccessTokenContext is like RefreshAccessToken but uses ctx
+// for the request.
+func (service *OAuth2Service) RefreshAccessTokenContext(ctx context.Context,
+	refreshToken string) (*Token, error) {
 	// http://tools.ietf.org/html/rfc6749#section-6
 	params := url.Values{}
 
@@ -127,14 +273,14 @@ func (service *OAuth2Service) RefreshAccessToken(refreshToken string) (
 	params.Set("refresh_token", refreshToken)
 	(*MyUrlValues)(&params).CheckAndSet("scope", service.Scope)
 
-	return service.getToken(params)
+	return service.getToken(ctx, params)
 }
 
 // If you need more custom parameters to get access token or OAuth 2.0
 // Extension Grants http://tools.ietf.org/html/rfc6749#section-4.5 you can
 // provide custom URL parameters.
-// "client_id", "client_secret", "redirect_uri" (if exists) will be added
-// by default.
+// "redirect_uri" (if exists) and client credentials (see ClientAuth) will be
+// added by default.
 //
 //		service := oauth2.Service(clId, clSecret, authURL, tokenURL)
 //		// get access code
@@ -145,33 +291,63 @@ func (service *OAuth2Service) RefreshAccessToken(refreshToken string) (
 //		myToken, err := service.GetToken(code, params)
 func (service *OAuth2Service) GetToken(accessCode string, params url.Values) (
 	*Token, error) {
+	return service.GetTokenContext(context.Background(), accessCode, params)
+}
+
+// GetTokenContext is like GetToken but uses ctx for the request.
+func (service *OAuth2Service) GetTokenContext(ctx context.Context,
+	accessCode string, params url.Values) (*Token, error) {
 	if len(accessCode) == 0 {
 		return nil, fmt.Errorf("Access code can't be empty")
 	}
-	params.Set("code", accessCode)
-	return service.getToken(params)
+	// Caller's params may be shared between requests, don't modify them.
+	tokenParams := url.Values{}
+	for key, val := range params {
+		tokenParams[key] = val
+	}
+	tokenParams.Set("code", accessCode)
+	return service.getToken(ctx, tokenParams)
 }
 
-// getToken makes request for token
-func (service *OAuth2Service) getToken(params url.Values) (
-	*Token, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", service.AccessTokenURL.String(), nil)
+// client returns HTTP client used to talk to the authorization server.
+func (service *OAuth2Service) client() *http.Client {
+	if service.Client == nil {
+		return http.DefaultClient
+	}
+	return service.Client
+}
+
+// clientAuth returns client authentication method used by service.
+func (service *OAuth2Service) clientAuth() ClientAuth {
+	if service.ClientAuth == nil {
+		return ClientAuthBody
+	}
+	return service.ClientAuth
+}
+
+// postForm sends params to endpoint, authenticating the client.
+// It returns the response with already read body.
+func (service *OAuth2Service) postForm(ctx context.Context, endpoint string,
+	params url.Values) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	params.Set("client_id", service.ClientId)
-	params.Set("client_secret", service.ClientSecret)
-	(*MyUrlValues)(&params).CheckAndSet("redirect_uri", service.RedirectURL)
+	// Client authentication can add its own headers, so don't modify
+	// the shared AuthHeader.
+	req.Header = cloneHeader(service.AuthHeader)
+	err = service.clientAuth().AuthenticateClient(
+		service.Config, req.Header, params)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	encParams := params.Encode()
 	reader := strings.NewReader(encParams)
 	req.Body = ioutil.NopCloser(reader)
 	req.ContentLength = int64(len(encParams))
 
-	req.Header = service.AuthHeader
-
 	//for key, val := range req.Header {
 	//	fmt.Println(key, val)
 	//}
@@ -179,9 +355,9 @@ func (service *OAuth2Service) getToken(params url.Values) (
 	//raw2, _ := ioutil.ReadAll(req.Body)
 	//fmt.Println(string(raw2))
 
-	resp, err := client.Do(req)
+	resp, err := service.client().Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Get the response body
@@ -191,6 +367,19 @@ func (service *OAuth2Service) getToken(params url.Values) (
 	//}
 	//fmt.Println(string(raw))
 	defer resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, raw, nil
+}
+
+// getToken makes request for token
+func (service *OAuth2Service) getToken(ctx context.Context,
+	params url.Values) (*Token, error) {
+	(*MyUrlValues)(&params).CheckAndSet("redirect_uri", service.RedirectURL)
+
+	resp, raw, err := service.postForm(ctx, service.AccessTokenURL.String(),
+		params)
 	if err != nil {
 		return nil, err
 	}
@@ -199,80 +388,67 @@ func (service *OAuth2Service) getToken(params url.Values) (
 	var localToken struct {
 		AccessToken  string `json:"access_token"`
 		TokenType    string `json:"token_type"`
-		ExpiresInt64 int64  `json:"expires_in"`
-		ExpiresIn    time.Duration
 		RefreshToken string `json:"refresh_token"`
 		Scope        string `json:"scope"`
 		State        string `json:"state"`
-	}
+		IDToken      string `json:"id_token"`
 
-	content, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
-	if err != nil {
-		return nil, err
+		IssuedTokenType string `json:"issued_token_type"`
 	}
+	// All response parameters, including not listed above
+	extra := map[string]interface{}{}
+
+	// Missing or invalid Content-Type is handled like JSON.
+	content, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
 	switch content {
 	case "application/x-www-form-urlencoded", "text/plain", "text/html":
 		vals, err := url.ParseQuery(string(raw))
 		if err != nil {
-			return nil, err
+			return nil, newParseError(resp, raw, err)
 		}
 		//for key, val := range vals {
 		//	fmt.Println(key, val)
 		//}
 		localToken.AccessToken = vals.Get("access_token")
 		localToken.TokenType = vals.Get("token_type")
-		localToken.ExpiresIn, _ = time.ParseDuration(vals.Get("expires") + "s")
 		localToken.RefreshToken = vals.Get("refresh_token")
 		localToken.Scope = vals.Get("scope")
 		localToken.State = vals.Get("state")
+		localToken.IDToken = vals.Get("id_token")
+		localToken.IssuedTokenType = vals.Get("issued_token_type")
+		for key := range vals {
+			extra[key] = vals.Get(key)
+		}
 	default:
 		if err := json.Unmarshal(raw, &localToken); err != nil {
-			return nil, err
+			return nil, newParseError(resp, raw, err)
+		}
+		if err := json.Unmarshal(raw, &extra); err != nil {
+			return nil, newParseError(resp, raw, err)
 		}
-		expiresIn := strconv.FormatInt(localToken.ExpiresInt64, 10)
-		localToken.ExpiresIn, _ = time.ParseDuration(expiresIn + "s")
+	}
+
+	if len(localToken.AccessToken) == 0 {
+		return nil, newResponseError(resp, raw)
 	}
 
 	// Create return token
 	token := Token{}
 	token.AccessToken = localToken.AccessToken
 	token.TokenType = localToken.TokenType
-	if localToken.ExpiresIn == 0 {
+	if expiresIn := service.expiresIn(extra); expiresIn == 0 {
 		token.ExpirationTime = time.Time{}
 	} else {
-		token.ExpirationTime = time.Now().Add(localToken.ExpiresIn)
+		token.ExpirationTime = time.Now().Add(expiresIn)
 	}
 	if len(localToken.RefreshToken) > 0 {
 		token.RefreshToken = localToken.RefreshToken
 	}
 	token.Scope = localToken.Scope
 	token.State = localToken.State
-
-	if len(token.AccessToken) == 0 {
-		tokenError := TokenError{}
-		switch content {
-		case "application/x-www-form-urlencoded", "text/plain", "text/html":
-			vals, err := url.ParseQuery(string(raw))
-			if err != nil {
-				return nil, err
-			}
-			tokenError.Error = vals.Get("error")
-			tokenError.Description = vals.Get("error_description")
-			tokenError.URI = vals.Get("error_uri")
-			tokenError.State = vals.Get("state")
-		default:
-			if err := json.Unmarshal(raw, &tokenError); err != nil {
-				return nil, err
-			}
-		}
-		return nil, fmt.Errorf("No access token found, "+
-			"error: %v, description: %v, URI: %v, state: %v",
-			tokenError.Error,
-			tokenError.Description,
-			tokenError.URI,
-			tokenError.State,
-		)
-	}
+	token.IDToken = localToken.IDToken
+	token.IssuedTokenType = localToken.IssuedTokenType
+	token.Raw = extra
 
 	return &token, nil
 }
@@ -285,6 +461,62 @@ func (token *Token) Expired() bool {
 	return token.ExpirationTime.Before(time.Now())
 }
 
+// expiresIn returns token lifetime from "expires_in" (or non-standard
+// "expires") response parameter. Number, string and float values are
+// accepted. DefaultTokenLifetime is used if it's missing.
+func (service *OAuth2Service) expiresIn(
+	params map[string]interface{}) time.Duration {
+	for _, key := range []string{"expires_in", "expires"} {
+		var seconds float64
+		switch value := params[key].(type) {
+		case float64:
+			seconds = value
+		case string:
+			var err error
+			seconds, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		if seconds > 0 && seconds < math.MaxInt64/float64(time.Second) {
+			return time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return service.DefaultTokenLifetime
+}
+
+// Extra returns token response parameter key, like "id_token" or
+// provider-specific "team", nil if it's missing. JSON numbers are
+// float64, form-encoded values are strings.
+func (token *Token) Extra(key string) interface{} {
+	return token.Raw[key]
+}
+
+// DecodeExtra decodes all token response parameters into v, which should
+// be a pointer to struct with json tags.
+//
+//	var extra struct {
+//		Login string `json:"login"`
+//	}
+//	err := token.DecodeExtra(&extra)
+func (token *Token) DecodeExtra(v interface{}) error {
+	data, err := json.Marshal(token.Raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// cloneHeader returns a deep copy of header, never nil.
+func cloneHeader(header http.Header) http.Header {
+	if header == nil {
+		return make(http.Header)
+	}
+	return header.Clone()
+}
+
 // MyUrlValues is a wrapper to a url.Values
 type MyUrlValues url.Values
 
@@ -0,0 +1,242 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// roundTripperFunc implements http.RoundTripper.
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestServiceClient(t *testing.T) {
+	server := newTokenServer(t)
+	service := server.service()
+	var sent int32
+	service.Client = &http.Client{
+		Transport: roundTripperFunc(func(r *http.Request) (
+			*http.Response, error) {
+			atomic.AddInt32(&sent, 1)
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+	if _, err := service.GetAccessToken("code"); err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadInt32(&sent) != 1 {
+		t.Errorf("Client sent %d requests, want 1", sent)
+	}
+}
+
+func TestGetAccessTokenContextCanceled(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+	service := Service("client", "secret", server.URL+"/authorize",
+		server.URL+"/token")
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	_, err := service.GetAccessTokenContext(ctx, "code")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestGetAuthorizeURL(t *testing.T) {
+	service := Service("client", "secret",
+		"https://example.com/authorize?tenant=t1", "https://example.com/token")
+	service.RedirectURL = "https://app.example.com/callback"
+	service.Scope = "openid profile"
+
+	first := service.GetAuthorizeURL("xyz")
+	// Parameters of the previous call aren't repeated.
+	second := service.GetAuthorizeURL("xyz")
+	if first != second {
+		t.Errorf("Second URL = %v, want %v", second, first)
+	}
+	query := parseURL(t, second).Query()
+	want := url.Values{
+		"tenant":        {"t1"},
+		"response_type": {"code"},
+		"client_id":     {"client"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid profile"},
+		"state":         {"xyz"},
+	}
+	if query.Encode() != want.Encode() {
+		t.Errorf("Query = %v, want %v", query, want)
+	}
+	if service.AuthorizeURL.RawQuery != "tenant=t1" {
+		t.Errorf("AuthorizeURL modified: %v", service.AuthorizeURL.String())
+	}
+}
+
+// TestServiceConcurrentUse must be run with -race.
+func TestServiceConcurrentUse(t *testing.T) {
+	server := newTokenServer(t)
+	service := Service("client", "secret", server.URL+"/authorize?tenant=t1",
+		server.URL+"/token")
+	service.ClientAuth = ClientAuthBasic
+	pkce, err := NewPKCE(PKCEMethodS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL := service.GetAuthorizeURL("xyz")
+	pkceURL := service.GetAuthorizeURLPKCE("xyz", pkce)
+	// Custom parameters shared by all requests.
+	shared := url.Values{"resource": {"https://api.example.com"}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if got := service.GetAuthorizeURL("xyz"); got != authURL {
+				t.Errorf("GetAuthorizeURL() = %v, want %v", got, authURL)
+			}
+			if got := service.GetAuthorizeURLPKCE("xyz", pkce); got != pkceURL {
+				t.Errorf("GetAuthorizeURLPKCE() = %v, want %v", got, pkceURL)
+			}
+			params := url.Values{}
+			params.Set("grant_type", "authorization_code")
+			params.Set("code", fmt.Sprint("code", i))
+			token, err := service.getToken(context.Background(), params)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if token.AccessToken != "at" {
+				t.Errorf("AccessToken = %q", token.AccessToken)
+			}
+			_, err = service.GetTokenContext(context.Background(),
+				fmt.Sprint("shared", i), shared)
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if server.count() != 40 {
+		t.Errorf("Sent %d token requests, want 40", server.count())
+	}
+	if len(shared) != 1 {
+		t.Errorf("Shared params modified: %v", shared)
+	}
+	for _, r := range server.requests {
+		if _, _, ok := r.BasicAuth(); !ok || len(r.PostForm["code"]) != 1 {
+			t.Errorf("Request = %v %v", r.Header, r.PostForm)
+		}
+	}
+	if service.AuthHeader.Get("Authorization") != "" {
+		t.Error("Service AuthHeader modified")
+	}
+}
+
+func TestTokenExtra(t *testing.T) {
+	service := staticServer(t, http.StatusOK, "application/json",
+		`{"access_token":"at","team":{"id":"T1"},"n":5}`)
+	token, err := service.GetAccessToken("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := token.Extra("n"); n != 5.0 {
+		t.Errorf("Extra(n) = %v, want 5", n)
+	}
+	if missing := token.Extra("missing"); missing != nil {
+		t.Errorf("Extra(missing) = %v, want nil", missing)
+	}
+	var extra struct {
+		Team struct {
+			ID string `json:"id"`
+		} `json:"team"`
+		N int `json:"n"`
+	}
+	if err := token.DecodeExtra(&extra); err != nil {
+		t.Fatal(err)
+	}
+	if extra.Team.ID != "T1" || extra.N != 5 {
+		t.Errorf("DecodeExtra() = %+v", extra)
+	}
+
+	service = staticServer(t, http.StatusOK,
+		"application/x-www-form-urlencoded", "access_token=at&login=bob")
+	token, err = service.GetAccessToken("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || token.Extra("login") != "bob" {
+		t.Errorf("Token = %+v", token)
+	}
+}
+
+func TestTokenExpiresIn(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+		want              time.Duration
+	}{
+		{"application/json", `{"access_token":"at","expires_in":3600}`, time.Hour},
+		{"application/json", `{"access_token":"at","expires_in":"3600"}`, time.Hour},
+		{"application/json", `{"access_token":"at","expires_in":3600.5}`,
+			time.Hour + time.Second/2},
+		{"application/json", `{"access_token":"at","expires":60}`, time.Minute},
+		{"text/plain", "access_token=at&expires_in=60", time.Minute},
+		{"text/plain", "access_token=at&expires=60", time.Minute},
+		{"text/plain", "access_token=at", 0},
+		{"application/json", `{"access_token":"at","expires_in":"soon"}`, 0},
+		{"application/json", `{"access_token":"at","expires_in":1e300}`, 0},
+	}
+	for _, test := range tests {
+		service := staticServer(t, http.StatusOK, test.contentType, test.body)
+		token, err := service.GetAccessToken("code")
+		if err != nil {
+			t.Fatalf("%v: %v", test.body, err)
+		}
+		if test.want == 0 {
+			if !token.ExpirationTime.IsZero() {
+				t.Errorf("%v: ExpirationTime = %v, want zero", test.body,
+					token.ExpirationTime)
+			}
+			continue
+		}
+		if lifetime := time.Until(token.ExpirationTime); lifetime > test.want ||
+			lifetime < test.want-time.Second {
+			t.Errorf("%v: lifetime = %v, want %v", test.body, lifetime,
+				test.want)
+		}
+	}
+
+	service := staticServer(t, http.StatusOK, "application/json",
+		`{"access_token":"at"}`)
+	service.DefaultTokenLifetime = time.Hour
+	token, err := service.GetAccessToken("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := time.Until(token.ExpirationTime); lifetime < 59*time.Minute {
+		t.Errorf("Default lifetime = %v, want %v", lifetime, time.Hour)
+	}
+}
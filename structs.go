@@ -11,12 +11,16 @@ Spec: http://tools.ietf.org/html/rfc6749
 package oauth2
 
 import (
+	"net/http"
 	"net/url"
 	"time"
 )
 
 // Config store configuration for OAuth 2.0 client.
 type Config struct {
+	// Authorization server issuer identifier, set by Discover
+	Issuer string
+
 	ClientId       string
 	ClientSecret   string
 	Scope          string
@@ -25,6 +29,32 @@ type Config struct {
 	RedirectURL    string
 	ResponseType   string
 	AccessType     string
+
+	// Device Authorization Endpoint
+	// http://tools.ietf.org/html/rfc8628#section-3.1
+	DeviceAuthorizationURL url.URL
+
+	// Token Revocation Endpoint
+	// http://tools.ietf.org/html/rfc7009#section-2
+	RevocationURL url.URL
+
+	// Token Introspection Endpoint
+	// http://tools.ietf.org/html/rfc7662#section-2
+	IntrospectionURL url.URL
+
+	// Pushed Authorization Request Endpoint
+	// http://tools.ietf.org/html/rfc9126#section-2
+	PushedAuthorizationURL url.URL
+
+	// OpenID Connect UserInfo Endpoint
+	UserInfoURL url.URL
+
+	// JSON Web Key Set document with the server's signing keys
+	JWKSURL url.URL
+
+	// Metadata holds discovered authorization server metadata,
+	// nil if service wasn't created with Discover.
+	Metadata *ServerMetadata
 }
 
 // Token represents a successful Access Token Response.
@@ -40,7 +70,7 @@ type Token struct {
 	TokenType string `json:"token_type"`
 
 	// The expiration time of the token, zero if unknown
-	ExpirationTime time.Time
+	ExpirationTime time.Time `json:"expiration_time"`
 
 	// The refresh token, which can be used to obtain new
 	// access tokens using the same authorization grant
@@ -53,14 +83,33 @@ type Token struct {
 	// authorization request.  The exact value received from the
 	// client.
 	State string `json:"state"`
+
+	// OpenID Connect ID Token, verify it with IDTokenVerifier.
+	// http://openid.net/specs/openid-connect-core-1_0.html#TokenResponse
+	IDToken string `json:"id_token"`
+
+	// Type of the issued token for token exchange, like
+	// TokenTypeAccessToken.
+	// http://tools.ietf.org/html/rfc8693#section-2.2.1
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+
+	// Raw holds all parameters of the token response, use Extra or
+	// DecodeExtra to read them.
+	Raw map[string]interface{} `json:"raw,omitempty"`
 }
 
-// Error represents a failed Access Token Response.
+// TokenError represents a failed Access Token Response.
+//
+//	var tokenError *oauth2.TokenError
+//	if errors.As(err, &tokenError) &&
+//		tokenError.ErrorCode == oauth2.ErrorInvalidGrant {
+//		// ask user to authorize again
+//	}
 type TokenError struct {
 	// http://tools.ietf.org/html/rfc6749#section-5.2
 
 	// A single ASCII [USASCII] error code
-	Error string `json:"error"`
+	ErrorCode string `json:"error"`
 
 	// A human-readable ASCII [USASCII] text providing
 	// additional information, used to assist the client developer in
@@ -76,4 +125,13 @@ type TokenError struct {
 	// authorization request.  The exact value received from the
 	// client.
 	State string `json:"state"`
+
+	// HTTP status code of the response
+	StatusCode int `json:"-"`
+
+	// HTTP response headers
+	Header http.Header `json:"-"`
+
+	// Raw response body
+	Body []byte `json:"-"`
 }
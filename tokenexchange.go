@@ -0,0 +1,110 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+/*
+Spec: http://tools.ietf.org/html/rfc8693
+*/
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Grant type for token exchange.
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token type identifiers used by token exchange.
+// http://tools.ietf.org/html/rfc8693#section-3
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+	TokenTypeIDToken      = "urn:ietf:params:oauth:token-type:id_token"
+	TokenTypeSAML1        = "urn:ietf:params:oauth:token-type:saml1"
+	TokenTypeSAML2        = "urn:ietf:params:oauth:token-type:saml2"
+	TokenTypeJWT          = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchange represents token exchange request, used for delegation
+// and impersonation.
+type TokenExchange struct {
+	// http://tools.ietf.org/html/rfc8693#section-2.1
+
+	// Token representing the party on behalf of whom the request is
+	// made, required
+	SubjectToken string
+
+	// Type of SubjectToken, like TokenTypeAccessToken, required
+	SubjectTokenType string
+
+	// Token representing the acting party, optional
+	ActorToken string
+
+	// Type of ActorToken, required if ActorToken is set
+	ActorTokenType string
+
+	// URIs of target services where the token will be used
+	Resource []string
+
+	// Logical names of target services where the token will be used
+	Audience []string
+
+	// Requested scope, space separated
+	Scope string
+
+	// Type of the requested token, like TokenTypeAccessToken
+	RequestedTokenType string
+}
+
+// ExchangeToken exchanges token for a new one, for example a downscoped
+// access token for another service. Token.IssuedTokenType is the type of
+// the issued token.
+//
+//	token, err := service.ExchangeToken(&oauth2.TokenExchange{
+//		SubjectToken:     userToken.AccessToken,
+//		SubjectTokenType: oauth2.TokenTypeAccessToken,
+//		Audience:         []string{"orders-api"},
+//		Scope:            "orders:read",
+//	})
+func (service *OAuth2Service) ExchangeToken(exchange *TokenExchange) (
+	*Token, error) {
+	return service.ExchangeTokenContext(context.Background(), exchange)
+}
+
+// ExchangeTokenContext is like ExchangeToken but uses ctx for
+// the request.
+func (service *OAuth2Service) ExchangeTokenContext(ctx context.Context,
+	exchange *TokenExchange) (*Token, error) {
+	if exchange.SubjectToken == "" || exchange.SubjectTokenType == "" {
+		return nil, fmt.Errorf("Subject token and its type can't be empty")
+	}
+	if exchange.ActorToken != "" && exchange.ActorTokenType == "" {
+		return nil, fmt.Errorf("Actor token type can't be empty")
+	}
+
+	params := url.Values{}
+
+	params.Set("grant_type", GrantTypeTokenExchange)
+	params.Set("subject_token", exchange.SubjectToken)
+	params.Set("subject_token_type", exchange.SubjectTokenType)
+	if exchange.ActorToken != "" {
+		params.Set("actor_token", exchange.ActorToken)
+		params.Set("actor_token_type", exchange.ActorTokenType)
+	}
+	for _, resource := range exchange.Resource {
+		params.Add("resource", resource)
+	}
+	for _, audience := range exchange.Audience {
+		params.Add("audience", audience)
+	}
+	(*MyUrlValues)(&params).CheckAndSet("scope", exchange.Scope)
+	(*MyUrlValues)(&params).CheckAndSet("requested_token_type",
+		exchange.RequestedTokenType)
+
+	return service.getToken(ctx, params)
+}
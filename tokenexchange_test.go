@@ -0,0 +1,72 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExchangeToken(t *testing.T) {
+	server := newTokenServer(t)
+	server.respond(http.StatusOK, `{"access_token":"exchanged",`+
+		`"issued_token_type":"`+TokenTypeAccessToken+`","token_type":"N_A"}`)
+	token, err := server.service().ExchangeToken(&TokenExchange{
+		SubjectToken:       "subject",
+		SubjectTokenType:   TokenTypeAccessToken,
+		ActorToken:         "actor",
+		ActorTokenType:     TokenTypeJWT,
+		Resource:           []string{"https://api.example.com"},
+		Audience:           []string{"orders", "billing"},
+		Scope:              "read",
+		RequestedTokenType: TokenTypeAccessToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "exchanged" ||
+		token.IssuedTokenType != TokenTypeAccessToken {
+		t.Errorf("Token = %+v", token)
+	}
+
+	form := server.last(t).PostForm
+	want := map[string][]string{
+		"grant_type":           {GrantTypeTokenExchange},
+		"subject_token":        {"subject"},
+		"subject_token_type":   {TokenTypeAccessToken},
+		"actor_token":          {"actor"},
+		"actor_token_type":     {TokenTypeJWT},
+		"resource":             {"https://api.example.com"},
+		"audience":             {"orders", "billing"},
+		"scope":                {"read"},
+		"requested_token_type": {TokenTypeAccessToken},
+	}
+	for key, values := range want {
+		if !reflect.DeepEqual(form[key], values) {
+			t.Errorf("%v = %v, want %v", key, form[key], values)
+		}
+	}
+}
+
+func TestExchangeTokenInvalid(t *testing.T) {
+	server := newTokenServer(t)
+	invalid := []*TokenExchange{
+		{SubjectToken: "subject"},
+		{SubjectTokenType: TokenTypeAccessToken},
+		{SubjectToken: "subject", SubjectTokenType: TokenTypeAccessToken,
+			ActorToken: "actor"},
+	}
+	for _, exchange := range invalid {
+		if _, err := server.service().ExchangeToken(exchange); err == nil {
+			t.Errorf("Exchange %+v accepted", exchange)
+		}
+	}
+	if server.count() != 0 {
+		t.Errorf("Sent %d requests, want 0", server.count())
+	}
+}
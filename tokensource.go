@@ -0,0 +1,163 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultExpiryDelta is how long before ExpirationTime tokens are
+// refreshed by RefreshTokenSource.
+const DefaultExpiryDelta = 10 * time.Second
+
+// TokenSource is anything that can return a token.
+type TokenSource interface {
+	// Token returns a valid token or an error.
+	Token() (*Token, error)
+}
+
+type staticTokenSource struct {
+	token *Token
+}
+
+// StaticTokenSource returns a TokenSource that always returns the same
+// token. Use it when token is never refreshed.
+func StaticTokenSource(token *Token) TokenSource {
+	return staticTokenSource{token}
+}
+
+func (s staticTokenSource) Token() (*Token, error) {
+	return s.token, nil
+}
+
+// RefreshTokenSource returns token refreshed with OAuth2Service when it
+// expires. It's safe for concurrent use.
+type RefreshTokenSource struct {
+	// ExpiryDelta is how long before ExpirationTime the token is
+	// treated as expired, default: DefaultExpiryDelta
+	ExpiryDelta time.Duration
+
+	// Store, if set, persists refreshed tokens under StoreKey
+	Store    TokenStore
+	StoreKey string
+
+	service *OAuth2Service
+
+	mu      sync.Mutex
+	token   *Token
+	unsaved bool
+}
+
+// TokenSource returns a TokenSource that returns token until it expires,
+// then refreshes it using token.RefreshToken.
+//
+//	token, err := service.GetAccessToken(code)
+//	src := service.TokenSource(token)
+//	api := oauth2.RequestTokenSource(apiBaseURL, src)
+func (service *OAuth2Service) TokenSource(token *Token) *RefreshTokenSource {
+	return &RefreshTokenSource{
+		ExpiryDelta: DefaultExpiryDelta,
+		service:     service,
+		token:       token,
+	}
+}
+
+// StoredTokenSource returns a TokenSource using token saved in store under
+// key. Refreshed tokens are saved back to store.
+//
+//	store := oauth2.NewFileTokenStore(dir)
+//	err := store.Save(userId, token)
+//	...
+//	src, err := service.StoredTokenSource(store, userId)
+func (service *OAuth2Service) StoredTokenSource(store TokenStore,
+	key string) (*RefreshTokenSource, error) {
+	token, err := store.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	src := service.TokenSource(token)
+	src.Store = store
+	src.StoreKey = key
+	return src, nil
+}
+
+// Token returns current token, refreshing it if it's expired.
+func (s *RefreshTokenSource) Token() (*Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext is like Token but uses ctx for the refresh request.
+func (s *RefreshTokenSource) TokenContext(ctx context.Context) (
+	*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Retry if save failed last time, the store must not keep the old
+	// refresh token.
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	if s.token != nil && !s.token.expiredWithin(s.ExpiryDelta) {
+		return s.token, nil
+	}
+	if s.token == nil || s.token.RefreshToken == "" {
+		return nil, fmt.Errorf("Token expired and refresh token is not set")
+	}
+
+	token, err := s.service.RefreshAccessTokenContext(ctx,
+		s.token.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	// http://tools.ietf.org/html/rfc6749#section-6
+	// The authorization server MAY issue a new refresh token, if not
+	// the old one stays valid.
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.token.RefreshToken
+	}
+	// Old refresh token may be already invalidated by the server, keep
+	// the new one even if it can't be saved now.
+	s.token = token
+	s.unsaved = s.Store != nil
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// save stores unsaved token in Store.
+func (s *RefreshTokenSource) save() error {
+	if !s.unsaved {
+		return nil
+	}
+	if err := s.Store.Save(s.StoreKey, s.token); err != nil {
+		return fmt.Errorf("Token store error: %v", err)
+	}
+	s.unsaved = false
+	return nil
+}
+
+// tokenFromSource gets token from src, using ctx if src supports it.
+func tokenFromSource(ctx context.Context, src TokenSource) (*Token, error) {
+	if ctxSrc, ok := src.(interface {
+		TokenContext(context.Context) (*Token, error)
+	}); ok {
+		return ctxSrc.TokenContext(ctx)
+	}
+	return src.Token()
+}
+
+// expiredWithin returns true if access token expires within delta.
+func (token *Token) expiredWithin(delta time.Duration) bool {
+	if token.ExpirationTime.IsZero() {
+		return false
+	}
+	return token.ExpirationTime.Before(time.Now().Add(delta))
+}
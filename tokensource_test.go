@@ -0,0 +1,169 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStaticTokenSource(t *testing.T) {
+	token := &Token{AccessToken: "at"}
+	got, err := StaticTokenSource(token).Token()
+	if err != nil || got != token {
+		t.Fatalf("Token() = %v, %v", got, err)
+	}
+}
+
+func TestRefreshTokenSource(t *testing.T) {
+	server := newTokenServer(t)
+	server.respond(http.StatusOK, `{"access_token":"new","expires_in":3600}`)
+	service := server.service()
+
+	valid := &Token{AccessToken: "valid", RefreshToken: "rt",
+		ExpirationTime: time.Now().Add(time.Hour)}
+	token, err := service.TokenSource(valid).Token()
+	if err != nil || token != valid {
+		t.Fatalf("Token() = %v, %v", token, err)
+	}
+	if server.count() != 0 {
+		t.Fatal("Valid token refreshed")
+	}
+
+	// Token expiring within ExpiryDelta is refreshed.
+	src := service.TokenSource(&Token{AccessToken: "old", RefreshToken: "rt",
+		ExpirationTime: time.Now().Add(DefaultExpiryDelta / 2)})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := src.Token()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if token.AccessToken != "new" {
+				t.Errorf("AccessToken = %q, want new", token.AccessToken)
+			}
+		}()
+	}
+	wg.Wait()
+	if server.count() != 1 {
+		t.Errorf("Refreshed %d times, want 1", server.count())
+	}
+	form := server.last(t).PostForm
+	if form.Get("grant_type") != "refresh_token" ||
+		form.Get("refresh_token") != "rt" {
+		t.Errorf("Form = %v", form)
+	}
+	// Server didn't issue a new refresh token, the old one is kept.
+	if token, _ := src.Token(); token.RefreshToken != "rt" {
+		t.Errorf("RefreshToken = %q, want rt", token.RefreshToken)
+	}
+}
+
+func TestRefreshTokenSourceWithoutRefreshToken(t *testing.T) {
+	server := newTokenServer(t)
+	src := server.service().TokenSource(&Token{AccessToken: "old",
+		ExpirationTime: time.Now().Add(-time.Minute)})
+	if _, err := src.Token(); err == nil {
+		t.Fatal("Expired token without refresh token returned")
+	}
+	if server.count() != 0 {
+		t.Error("Refresh request sent")
+	}
+}
+
+func TestRequestTokenSource(t *testing.T) {
+	server := newTokenServer(t)
+	src := server.service().TokenSource(&Token{AccessToken: "old",
+		RefreshToken: "rt", ExpirationTime: time.Now().Add(-time.Minute)})
+	api := RequestTokenSource(server.URL+"/api", src)
+	api.AccessTokenInHeader = true
+
+	resp, err := api.Get("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	r := server.last(t)
+	if r.URL.Path != "/api/users" ||
+		r.Header.Get("Authorization") != "Bearer at" {
+		t.Errorf("Request = %v, Authorization: %q", r.URL,
+			r.Header.Get("Authorization"))
+	}
+}
+
+func TestStoredTokenSource(t *testing.T) {
+	server := newTokenServer(t)
+	store := NewMemoryTokenStore()
+	service := server.service()
+	if _, err := service.StoredTokenSource(store, "user"); err != ErrTokenNotFound {
+		t.Fatalf("Error = %v, want ErrTokenNotFound", err)
+	}
+
+	store.Save("user", &Token{AccessToken: "old", RefreshToken: "old-rt",
+		ExpirationTime: time.Now().Add(-time.Minute)})
+	src, err := service.StoredTokenSource(store, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Token(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := store.Load("user")
+	if err != nil || saved.AccessToken != "at" || saved.RefreshToken != "rt" {
+		t.Fatalf("Saved token = %v, %v", saved, err)
+	}
+}
+
+// failingTokenStore fails to save tokens while fail is set.
+type failingTokenStore struct {
+	MemoryTokenStore
+	fail bool
+}
+
+func (store *failingTokenStore) Save(key string, token *Token) error {
+	if store.fail {
+		return errors.New("Disk full")
+	}
+	return store.MemoryTokenStore.Save(key, token)
+}
+
+func TestStoredTokenSourceSaveRetry(t *testing.T) {
+	server := newTokenServer(t)
+	store := &failingTokenStore{}
+	store.Save("user", &Token{AccessToken: "old", RefreshToken: "old-rt",
+		ExpirationTime: time.Now().Add(-time.Minute)})
+	src, err := server.service().StoredTokenSource(store, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.fail = true
+	if _, err := src.Token(); err == nil {
+		t.Fatal("Store error not returned")
+	}
+	// Refreshed token is kept and saved by the next call, the old
+	// refresh token may be already revoked.
+	store.fail = false
+	token, err := src.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "at" || server.count() != 1 {
+		t.Errorf("Token = %v after %d refreshes", token, server.count())
+	}
+	saved, err := store.Load("user")
+	if err != nil || saved.RefreshToken != "rt" {
+		t.Errorf("Saved token = %v, %v", saved, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrTokenNotFound is returned by TokenStore.Load when there is no token
+// saved under the key.
+var ErrTokenNotFound = errors.New("Token not found")
+
+// TokenStore persists tokens, keyed by user or client.
+type TokenStore interface {
+	// Load returns token saved under key or ErrTokenNotFound.
+	Load(key string) (*Token, error)
+
+	// Save stores token under key, replacing the previous one.
+	Save(key string, token *Token) error
+
+	// Delete removes token saved under key. Deleting missing token is
+	// not an error.
+	Delete(key string) error
+}
+
+// MemoryTokenStore keeps tokens in memory. Zero value is ready to use.
+// It's safe for concurrent use.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+// NewMemoryTokenStore initializes empty MemoryTokenStore.
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{tokens: map[string]Token{}}
+}
+
+// Load implements TokenStore.
+func (store *MemoryTokenStore) Load(key string) (*Token, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	token, ok := store.tokens[key]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (store *MemoryTokenStore) Save(key string, token *Token) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.tokens == nil {
+		store.tokens = map[string]Token{}
+	}
+	store.tokens[key] = *token
+	return nil
+}
+
+// Delete implements TokenStore.
+func (store *MemoryTokenStore) Delete(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.tokens, key)
+	return nil
+}
+
+// FileTokenStore keeps tokens as JSON files in a directory, one file per
+// key. Files are readable only by the owner and replaced atomically.
+//
+// If Key is set, tokens are encrypted with AES-GCM.
+type FileTokenStore struct {
+	// Directory for token files, created if it doesn't exist
+	Dir string
+
+	// AES key (16, 24 or 32 bytes), optional
+	Key []byte
+}
+
+// NewFileTokenStore initializes FileTokenStore saving tokens in dir.
+func NewFileTokenStore(dir string) *FileTokenStore {
+	return &FileTokenStore{Dir: dir}
+}
+
+// NewEncryptedFileTokenStore initializes FileTokenStore saving tokens in
+// dir, encrypted with AES-GCM using key.
+func NewEncryptedFileTokenStore(dir string, key []byte) (
+	*FileTokenStore, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("Token store key error: %v", err)
+	}
+	return &FileTokenStore{Dir: dir, Key: key}, nil
+}
+
+// Load implements TokenStore.
+func (store *FileTokenStore) Load(key string) (*Token, error) {
+	data, err := ioutil.ReadFile(store.filename(key))
+	if os.IsNotExist(err) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if store.Key != nil {
+		if data, err = store.decrypt(key, data); err != nil {
+			return nil, err
+		}
+	}
+	token := Token{}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("Token file error: %v", err)
+	}
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (store *FileTokenStore) Save(key string, token *Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if store.Key != nil {
+		if data, err = store.encrypt(key, data); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(store.Dir, 0700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so readers never see
+	// a partially written token.
+	tmp, err := ioutil.TempFile(store.Dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), store.filename(key))
+}
+
+// Delete implements TokenStore.
+func (store *FileTokenStore) Delete(key string) error {
+	err := os.Remove(store.filename(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// filename returns token file path, key is hashed so any string can be
+// used as key.
+func (store *FileTokenStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(store.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (store *FileTokenStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(store.Key)
+	if err != nil {
+		return nil, fmt.Errorf("Token store key error: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals data with random nonce prepended. Key is used as
+// additional data, so files can't be swapped between keys.
+func (store *FileTokenStore) encrypt(key string, data []byte) (
+	[]byte, error) {
+	aead, err := store.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, []byte(key)), nil
+}
+
+func (store *FileTokenStore) decrypt(key string, data []byte) (
+	[]byte, error) {
+	aead, err := store.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("Token file is too short")
+	}
+	nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+	data, err = aead.Open(nil, nonce, sealed, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("Token file decryption failed")
+	}
+	return data, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenStores(t *testing.T) {
+	dir := t.TempDir()
+	encrypted, err := NewEncryptedFileTokenStore(filepath.Join(dir, "enc"),
+		bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]TokenStore{
+		"memory":    NewMemoryTokenStore(),
+		"zero":      &MemoryTokenStore{},
+		"file":      NewFileTokenStore(filepath.Join(dir, "plain")),
+		"encrypted": encrypted,
+	}
+	for name, store := range stores {
+		if _, err := store.Load("user"); err != ErrTokenNotFound {
+			t.Errorf("%v: Load() error = %v, want ErrTokenNotFound", name,
+				err)
+		}
+		token := &Token{AccessToken: "at", RefreshToken: "rt",
+			ExpirationTime: time.Now().Add(time.Hour).Round(0)}
+		if err := store.Save("user", token); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if err := store.Save("other/user", &Token{AccessToken: "other"}); err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		loaded, err := store.Load("user")
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if loaded.AccessToken != "at" || loaded.RefreshToken != "rt" ||
+			!loaded.ExpirationTime.Equal(token.ExpirationTime) {
+			t.Errorf("%v: Load() = %+v", name, loaded)
+		}
+
+		if err := store.Delete("user"); err != nil {
+			t.Errorf("%v: %v", name, err)
+		}
+		if _, err := store.Load("user"); err != ErrTokenNotFound {
+			t.Errorf("%v: Load() after Delete() error = %v", name, err)
+		}
+		if err := store.Delete("user"); err != nil {
+			t.Errorf("%v: Delete() of missing token = %v", name, err)
+		}
+		if loaded, err := store.Load("other/user"); err != nil ||
+			loaded.AccessToken != "other" {
+			t.Errorf("%v: Load() = %v, %v", name, loaded, err)
+		}
+	}
+}
+
+func TestFileTokenStoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewEncryptedFileTokenStore(dir, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("user", &Token{AccessToken: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Files = %v, %v", files, err)
+	}
+	info, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("File mode = %v, want 0600", info.Mode())
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Error("Token saved in plain text")
+	}
+
+	// Key is authenticated, files can't be swapped between keys.
+	if err := os.Rename(files[0], store.filename("admin")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("admin"); err == nil {
+		t.Error("Token of other key loaded")
+	}
+
+	other := &FileTokenStore{Dir: dir, Key: bytes.Repeat([]byte{2}, 32)}
+	if _, err := other.Load("admin"); err == nil {
+		t.Error("Token decrypted with wrong key")
+	}
+}
+
+func TestNewEncryptedFileTokenStoreInvalidKey(t *testing.T) {
+	if _, err := NewEncryptedFileTokenStore(t.TempDir(),
+		[]byte("short")); err == nil {
+		t.Fatal("Invalid AES key accepted")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that authenticates each request with
+// access token obtained from Source. Token placement follows the same
+// rules as in ResRequest.
+//
+//	src := service.TokenSource(token)
+//	client := &http.Client{Transport: oauth2.NewTransport(src)}
+//	resp, err := client.Get("https://api.example.com/user")
+type Transport struct {
+	// Source supplies access tokens, usually RefreshTokenSource
+	Source TokenSource
+
+	// Base is used to send requests, default: http.DefaultTransport
+	Base http.RoundTripper
+
+	// Set AccessTokenInURL to true if destination service require
+	// authorization in the HTTP request URI
+	AccessTokenInURL bool
+	// Authentication URI parameter, default: "access_token"
+	AccessTokenInURLParam string
+
+	// Set AccessTokenInHeader to true if destination service require
+	// authorization in the "Authorization" request header
+	AccessTokenInHeader bool
+	// Authentication header scheme, default: "Bearer"
+	AccessTokenInHeaderScheme string
+}
+
+// NewTransport initializes Transport sending access token from src
+// in the "Authorization: Bearer" request header.
+func NewTransport(src TokenSource) *Transport {
+	return &Transport{
+		Source:                    src,
+		AccessTokenInURLParam:     "access_token",
+		AccessTokenInHeader:       true,
+		AccessTokenInHeaderScheme: "Bearer",
+	}
+}
+
+// NewClient returns HTTP client sending requests authenticated with token,
+// refreshed by service when it expires.
+func (service *OAuth2Service) NewClient(token *Token) *http.Client {
+	return &http.Client{Transport: NewTransport(service.TokenSource(token))}
+}
+
+// RoundTrip authorizes and sends HTTP request. Original request is
+// not modified.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	closeBody := func() {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+	}
+	if t.Source == nil {
+		closeBody()
+		return nil, errors.New("Transport's Source is nil")
+	}
+	token, err := tokenFromSource(req.Context(), t.Source)
+	if err != nil {
+		closeBody()
+		return nil, err
+	}
+
+	// http://golang.org/pkg/net/http/#RoundTripper
+	// RoundTrip should not modify the request.
+	authReq := req.Clone(req.Context())
+	if t.AccessTokenInURL {
+		param := t.AccessTokenInURLParam
+		if param == "" {
+			param = "access_token"
+		}
+		setTokenInURL(authReq.URL, param, token.AccessToken)
+	}
+	if t.AccessTokenInHeader {
+		scheme := t.AccessTokenInHeaderScheme
+		if scheme == "" {
+			scheme = "Bearer"
+		}
+		setTokenInHeader(authReq.Header, scheme, token.AccessToken)
+	}
+	return t.base().RoundTrip(authReq)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Dobrosław Żybort
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package oauth2
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTransport(t *testing.T) {
+	server := newTokenServer(t)
+	transport := NewTransport(StaticTokenSource(&Token{AccessToken: "at"}))
+	transport.AccessTokenInURL = true
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequest("GET", server.URL+"/api?a=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	sent := server.last(t)
+	if sent.Header.Get("Authorization") != "Bearer at" {
+		t.Errorf("Authorization = %q", sent.Header.Get("Authorization"))
+	}
+	if sent.URL.RawQuery != "a=1&access_token=at" {
+		t.Errorf("Query = %q", sent.URL.RawQuery)
+	}
+	// http://golang.org/pkg/net/http/#RoundTripper
+	if req.Header.Get("Authorization") != "" || req.URL.RawQuery != "a=1" {
+		t.Error("Original request modified")
+	}
+}
+
+func TestServiceNewClient(t *testing.T) {
+	server := newTokenServer(t)
+	client := server.service().NewClient(&Token{AccessToken: "old",
+		RefreshToken: "rt", ExpirationTime: time.Now().Add(-time.Minute)})
+
+	resp, err := client.Get(server.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if server.count() != 2 {
+		t.Fatalf("Sent %d requests, want refresh and API request",
+			server.count())
+	}
+	if got := server.last(t).Header.Get("Authorization"); got != "Bearer at" {
+		t.Errorf("Authorization = %q, want refreshed token", got)
+	}
+}
+
+func TestTransportWithoutSource(t *testing.T) {
+	client := &http.Client{Transport: &Transport{}}
+	if _, err := client.Get("http://127.0.0.1/"); err == nil {
+		t.Fatal("Request without Source sent")
+	}
+}